@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+
+	"pathpad/internal/client"
+	"pathpad/internal/config"
+	"pathpad/internal/models"
+	"pathpad/internal/ot"
+	"pathpad/internal/sse"
+)
+
+const clientUsage = `Usage: pathpad client [-server URL] [-token TOKEN] [-name NAME] <command> [arguments]
+
+Commands:
+  cat <path>                  Print a page
+  put <path>                  Replace a page with standard input
+  ls [path]                   List a page's children
+  tree [path]                 Show all pages below a page
+  rm [-y] <path>              Delete a page and its children
+  edit <path>                 Edit a page in $EDITOR and save it on exit
+  tail [-f] <path>            Print a page, and with -f keep printing its updates
+
+The server defaults to PATHPAD_URL, or http://localhost:PATHPAD_PORT.
+The access token defaults to PATHPAD_TOKEN, and the name saves are
+attributed to defaults to PATHPAD_NAME.
+`
+
+func clientCommand(cfg *config.Config, args []string) error {
+	defaultServer := os.Getenv("PATHPAD_URL")
+	if defaultServer == "" {
+		defaultServer = "http://localhost:" + cfg.Port
+	}
+
+	flags := newFlagSet("client", "[-server URL] [-token TOKEN] [-name NAME] <command> [arguments]")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), clientUsage)
+	}
+	server := flags.String("server", defaultServer, "Pathpad server URL")
+	token := flags.String("token", os.Getenv("PATHPAD_TOKEN"), "access token or share link token")
+	name := flags.String("name", os.Getenv("PATHPAD_NAME"), "display name to attribute saves to")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+
+	c := client.New(*server)
+	c.Token = *token
+	c.Name = *name
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "cat":
+		return clientCat(c, args)
+	case "put":
+		return clientPut(c, args)
+	case "ls":
+		return clientLs(c, args)
+	case "tree":
+		return clientTree(c, args)
+	case "rm":
+		return clientRm(c, args)
+	case "edit":
+		return clientEdit(c, args)
+	case "tail":
+		return clientTail(c, args)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// parseClientPath parses the single path argument of a client command. With
+// optional set, a missing path means the root pad.
+func parseClientPath(flags *flag.FlagSet, args []string, optional bool) (string, error) {
+	flags.Parse(args)
+	switch {
+	case flags.NArg() == 0 && optional:
+		return "", nil
+	case flags.NArg() != 1:
+		flags.Usage()
+		return "", fmt.Errorf("expected a path")
+	}
+	return parsePath(flags.Arg(0))
+}
+
+func clientCat(c *client.Client, args []string) error {
+	path, err := parseClientPath(newFlagSet("client cat", "<path>"), args, false)
+	if err != nil {
+		return err
+	}
+
+	pad, err := c.GetPad(path)
+	if err != nil {
+		return err
+	}
+	fmt.Print(pad.Content)
+	return nil
+}
+
+func clientPut(c *client.Client, args []string) error {
+	path, err := parseClientPath(newFlagSet("client put", "<path> < file"), args, false)
+	if err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	pad, err := c.SavePad(path, string(content), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved /%s (version %d)\n", pad.Path, pad.Version)
+	return nil
+}
+
+func clientLs(c *client.Client, args []string) error {
+	path, err := parseClientPath(newFlagSet("client ls", "[path]"), args, true)
+	if err != nil {
+		return err
+	}
+
+	children, err := c.GetChildren(path)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		fmt.Printf("%s  /%s\n", time.Unix(child.UpdatedAt, 0).Format("2006-01-02 15:04"), child.Path)
+	}
+	return nil
+}
+
+func clientTree(c *client.Client, args []string) error {
+	path, err := parseClientPath(newFlagSet("client tree", "[path]"), args, true)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("/" + path)
+	return printTree(c, path, "")
+}
+
+// printTree prints the descendants of path, one level per recursive call.
+func printTree(c *client.Client, path, indent string) error {
+	children, err := c.GetChildren(path)
+	if err != nil {
+		return err
+	}
+	for i, child := range children {
+		branch, nextIndent := "├── ", indent+"│   "
+		if i == len(children)-1 {
+			branch, nextIndent = "└── ", indent+"    "
+		}
+		name := child.Path[strings.LastIndex(child.Path, "/")+1:]
+		fmt.Println(indent + branch + name)
+		if err := printTree(c, child.Path, nextIndent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clientRm(c *client.Client, args []string) error {
+	flags := newFlagSet("client rm", "[-y] <path>")
+	yes := flags.Bool("y", false, "don't ask before deleting many pages")
+	path, err := parseClientPath(flags, args, false)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := c.DeletePad(path, 0)
+	var confirm *client.ConfirmError
+	if errors.As(err, &confirm) {
+		if !*yes && !askYesNo(fmt.Sprintf("Delete /%s and its children, %d pages in total?", path, confirm.Count)) {
+			return errors.New("cancelled")
+		}
+		deleted, err = c.DeletePad(path, confirm.Count)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Deleted %d pages\n", deleted)
+	return nil
+}
+
+// askYesNo asks a question on the terminal and reports whether it was
+// answered with yes.
+func askYesNo(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func clientEdit(c *client.Client, args []string) error {
+	path, err := parseClientPath(newFlagSet("client edit", "<path>"), args, false)
+	if err != nil {
+		return err
+	}
+
+	pad, err := c.GetPad(path)
+	if err != nil {
+		return err
+	}
+
+	name := "root"
+	if path != "" {
+		name = strings.ReplaceAll(path, "/", "-")
+	}
+	f, err := os.CreateTemp("", "pathpad-"+name+"-*.md")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	_, err = f.WriteString(pad.Content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Run through the shell so EDITOR can carry arguments, e.g. "code --wait".
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmpPath)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("run editor: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return err
+	}
+	if string(edited) == pad.Content {
+		os.Remove(tmpPath)
+		fmt.Fprintln(os.Stderr, "No changes")
+		return nil
+	}
+
+	// Only save over the version that was edited, so changes made in the
+	// meantime by someone else aren't lost.
+	saved, err := c.SavePad(path, string(edited), &pad.Version)
+	if errors.Is(err, client.ErrVersionConflict) {
+		return fmt.Errorf("/%s was changed while you were editing; your version is in %s", path, tmpPath)
+	}
+	if err != nil {
+		return fmt.Errorf("%w; your version is in %s", err, tmpPath)
+	}
+	os.Remove(tmpPath)
+	fmt.Fprintf(os.Stderr, "Saved /%s (version %d)\n", path, saved.Version)
+	return nil
+}
+
+func clientTail(c *client.Client, args []string) error {
+	flags := newFlagSet("client tail", "[-f] <path>")
+	follow := flags.Bool("f", false, "keep printing the page as it changes")
+	path, err := parseClientPath(flags, args, false)
+	if err != nil {
+		return err
+	}
+
+	pad, err := c.GetPad(path)
+	if err != nil {
+		return err
+	}
+	if !*follow {
+		fmt.Print(pad.Content)
+		return nil
+	}
+	printPad(pad)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	clientID := newClientID()
+	content, version := pad.Content, pad.Version
+	onEvent := func(event sse.Event) error {
+		switch event.Type {
+		case "update", "op":
+			if len(event.Ops) > 0 && event.Version == version+1 {
+				// Operations apply to the version before the event's.
+				if next, err := ot.Apply(content, event.Ops); err == nil {
+					content, version = next, event.Version
+					printPad(&models.Pad{Path: path, Content: content, Version: version})
+					return nil
+				}
+			}
+			if len(event.Ops) == 0 && event.Type == "update" {
+				content, version = event.Content, event.Version
+				printPad(&models.Pad{Path: path, Content: content, Version: version})
+				return nil
+			}
+			// Missed an operation; start again from the server's copy.
+			return catchUp(c, path, &content, &version)
+		case "delete":
+			content, version = "", 0
+			fmt.Printf("==> /%s deleted <==\n", path)
+		case "moved":
+			fmt.Printf("==> /%s moved to /%s <==\n", path, event.Destination)
+		}
+		return nil
+	}
+
+	// The server closes event streams after a while, so reconnect until
+	// interrupted, catching up on anything missed in between.
+	for {
+		err := c.Follow(ctx, path, clientID, onEvent)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pathpad client tail: %v; reconnecting\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+		if err := catchUp(c, path, &content, &version); err != nil {
+			fmt.Fprintf(os.Stderr, "pathpad client tail: %v\n", err)
+		}
+	}
+}
+
+// catchUp fetches a pad and prints it if it changed since version.
+func catchUp(c *client.Client, path string, content *string, version *int64) error {
+	pad, err := c.GetPad(path)
+	if err != nil {
+		return err
+	}
+	if pad.Version != *version {
+		*content, *version = pad.Content, pad.Version
+		printPad(pad)
+	}
+	return nil
+}
+
+// printPad prints a pad's content under a header, like tail does for
+// several files.
+func printPad(pad *models.Pad) {
+	fmt.Printf("==> /%s (version %d) <==\n", pad.Path, pad.Version)
+	fmt.Print(pad.Content)
+	if pad.Content != "" && !strings.HasSuffix(pad.Content, "\n") {
+		fmt.Println()
+	}
+}
+
+// newClientID returns a random ID for subscribing to events.
+func newClientID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "cli-" + hex.EncodeToString(b)
+}
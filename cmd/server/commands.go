@@ -0,0 +1,324 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"pathpad/internal/archive"
+	"pathpad/internal/config"
+	"pathpad/internal/models"
+	"pathpad/internal/storage"
+)
+
+const usage = `Usage: pathpad [command] [arguments]
+
+Commands:
+  serve                       Start the server (the default)
+  export <prefix> <file>      Export a page and its children to a .zip or .tar.gz file
+  import <file> <prefix>      Import a .zip or .tar.gz file under a page
+  backup <dest>               Write a consistent snapshot of the database to dest
+  migrate                     Bring the database schema up to date and list its versions
+  vacuum                      Compact the database file
+  client <command>            Read and write pages on a running server
+
+The export, import, backup, migrate and vacuum commands work directly on the
+SQLite database at PATHPAD_DB_PATH and can be run while the server is
+running; migrate also handles PostgreSQL when PATHPAD_STORAGE=postgres. Use
+"/" as the prefix for the root page. Run "pathpad <command> -h" for a
+command's options.
+`
+
+// run dispatches a subcommand.
+func run(cfg *config.Config, command string, args []string) error {
+	switch command {
+	case "serve":
+		if len(args) > 0 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+		}
+		serve(cfg)
+		return nil
+	case "export":
+		return exportCommand(cfg, args)
+	case "import":
+		return importCommand(cfg, args)
+	case "backup":
+		return backupCommand(cfg, args)
+	case "migrate":
+		return migrateCommand(cfg, args)
+	case "vacuum":
+		return vacuumCommand(cfg, args)
+	case "client":
+		return clientCommand(cfg, args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// newFlagSet returns a flag set for a subcommand that prints its usage line
+// and options on -h.
+func newFlagSet(command, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pathpad %s %s\n", command, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses a subcommand's flags and checks that exactly n positional
+// arguments are left.
+func parseArgs(flags *flag.FlagSet, args []string, n int) ([]string, error) {
+	flags.Parse(args)
+	if flags.NArg() != n {
+		flags.Usage()
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, flags.NArg())
+	}
+	return flags.Args(), nil
+}
+
+// openDB opens the configured SQLite database, running any pending
+// migrations.
+func openDB(cfg *config.Config) (*storage.SQLiteStore, error) {
+	store, err := storage.NewSQLiteStore(cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	store.SetRevisionRetention(cfg.HistoryMaxRevisions, cfg.HistoryMaxAge)
+	store.SetTrashRetention(cfg.TrashRetention)
+	return store, nil
+}
+
+// parsePath turns a path argument such as "/notes/todo" into a validated pad
+// path. "/" is the root pad.
+func parsePath(arg string) (string, error) {
+	path := models.NormalizePath(arg)
+	if err := models.ValidatePath(path); err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", arg, err)
+	}
+	return path, nil
+}
+
+func exportCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("export", "[-format zip|tar.gz] <prefix> <file>")
+	format := flags.String("format", "", `archive format, "zip" or "tar.gz" (default: from the file name)`)
+	args, err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	prefix, err := parsePath(args[0])
+	if err != nil {
+		return err
+	}
+	dest := args[1]
+	if *format == "" {
+		*format = archive.FormatZip
+		if strings.HasSuffix(dest, ".tar.gz") || strings.HasSuffix(dest, ".tgz") {
+			*format = archive.FormatTarGz
+		}
+	}
+	if !archive.ValidFormat(*format) {
+		return fmt.Errorf(`unknown format %q (expected "zip" or "tar.gz")`, *format)
+	}
+
+	store, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	pads, err := store.GetSubtree(prefix)
+	if err != nil {
+		return err
+	}
+	if len(pads) == 0 {
+		return fmt.Errorf("no pages under %q", args[0])
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := archive.Write(f, *format, prefix, pads); err != nil {
+		f.Close()
+		os.Remove(dest)
+		return fmt.Errorf("write archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d pages to %s\n", len(pads), dest)
+	return nil
+}
+
+func importCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("import", "[-on-conflict skip|overwrite|rename] [-dry-run] [-author name] <file> <prefix>")
+	onConflict := flags.String("on-conflict", storage.ImportSkip, `what to do with pages that already exist: "skip", "overwrite" or "rename"`)
+	dryRun := flags.Bool("dry-run", false, "only report what would be imported")
+	author := flags.String("author", "", "name to record as the author of the imported pages")
+	args, err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	switch *onConflict {
+	case storage.ImportSkip, storage.ImportOverwrite, storage.ImportRename:
+	default:
+		return fmt.Errorf(`-on-conflict must be "skip", "overwrite" or "rename"`)
+	}
+	prefix, err := parsePath(args[1])
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, cfg.MaxImportSize+1))
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > cfg.MaxImportSize {
+		return fmt.Errorf("%s is larger than PATHPAD_MAX_IMPORT_SIZE (%d bytes)", args[0], cfg.MaxImportSize)
+	}
+
+	files, err := archive.Read(data, cfg.MaxContentSize, cfg.MaxImportSize)
+	if err != nil {
+		return err
+	}
+	pads, names, invalid := archive.Pads(files, prefix)
+
+	store, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	results, err := store.ImportPads(prefix, pads, *onConflict, *dryRun, *author)
+	if err != nil {
+		return err
+	}
+
+	var imported int
+	for i, result := range results {
+		if result.Status != "skipped" {
+			imported++
+		}
+		fmt.Printf("%-11s /%s (%s)\n", result.Status, result.Path, names[i])
+	}
+	for _, file := range invalid {
+		fmt.Printf("%-11s %s: %s\n", "invalid", file.File, file.Error)
+	}
+
+	if *dryRun {
+		fmt.Printf("Dry run: %d pages would be imported\n", imported)
+	} else {
+		fmt.Printf("Imported %d pages\n", imported)
+	}
+	return nil
+}
+
+func backupCommand(cfg *config.Config, args []string) error {
+	args, err := parseArgs(newFlagSet("backup", "<dest>"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	store, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.Backup(args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s\n", cfg.DBPath, args[0])
+	return nil
+}
+
+func migrateCommand(cfg *config.Config, args []string) error {
+	if _, err := parseArgs(newFlagSet("migrate", ""), args, 0); err != nil {
+		return err
+	}
+
+	// Opening a store runs its pending migrations.
+	var history []storage.AppliedMigration
+	switch cfg.Storage {
+	case "sqlite":
+		store, err := openDB(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if history, err = store.SchemaHistory(); err != nil {
+			return err
+		}
+		fmt.Printf("Database %s is up to date\n", cfg.DBPath)
+
+	case "postgres":
+		if cfg.PostgresDSN == "" {
+			return fmt.Errorf("PATHPAD_POSTGRES_DSN is required for the postgres backend")
+		}
+		store, err := storage.NewPostgresStore(cfg.PostgresDSN)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if history, err = store.SchemaHistory(); err != nil {
+			return err
+		}
+		fmt.Println("PostgreSQL database is up to date")
+
+	default:
+		return fmt.Errorf("the %s backend has no schema to migrate", cfg.Storage)
+	}
+
+	for _, applied := range history {
+		when := "before timestamps were recorded"
+		if applied.AppliedAt > 0 {
+			when = time.Unix(applied.AppliedAt, 0).Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  v%-3d %-32s %s\n", applied.Version, applied.Description, when)
+	}
+	return nil
+}
+
+func vacuumCommand(cfg *config.Config, args []string) error {
+	if _, err := parseArgs(newFlagSet("vacuum", ""), args, 0); err != nil {
+		return err
+	}
+
+	store, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	before := fileSize(cfg.DBPath)
+	if err := store.Vacuum(); err != nil {
+		return err
+	}
+	fmt.Printf("Vacuumed %s: %d -> %d bytes\n", cfg.DBPath, before, fileSize(cfg.DBPath))
+	return nil
+}
+
+// fileSize returns the size of the file at path, or 0 if it can't be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -9,7 +10,9 @@ import (
 	"syscall"
 	"time"
 
+	"pathpad/internal/access"
 	"pathpad/internal/api"
+	"pathpad/internal/auth"
 	"pathpad/internal/config"
 	"pathpad/internal/sse"
 	"pathpad/internal/storage"
@@ -19,13 +22,26 @@ import (
 func main() {
 	cfg := config.Load()
 
+	// Without a subcommand the binary starts the server, as it always has.
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	if err := run(cfg, command, args); err != nil {
+		fmt.Fprintf(os.Stderr, "pathpad %s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+// serve runs the HTTP server until it receives SIGINT or SIGTERM.
+func serve(cfg *config.Config) {
 	log.Printf("[startup] Pathpad server starting on port %s", cfg.Port)
-	log.Printf("[startup] DB path: %s", cfg.DBPath)
 
-	// Initialize SQLite store.
-	store, err := storage.NewSQLiteStore(cfg.DBPath)
+	// Initialize the storage backend.
+	store, err := openStore(cfg)
 	if err != nil {
-		log.Fatalf("[startup] Failed to initialize database: %v", err)
+		log.Fatalf("[startup] Failed to initialize storage: %v", err)
 	}
 	defer store.Close()
 
@@ -35,10 +51,59 @@ func main() {
 	// Initialize SSE broadcaster.
 	broadcaster := sse.NewBroadcaster(cfg.SSEMaxClients, cfg.SSEKeepalive)
 
-	log.Printf("[startup] Database initialized successfully")
+	log.Printf("[startup] Storage initialized successfully")
+
+	// Pick up pads edited outside of Pathpad, e.g. Markdown files on disk.
+	if cfg.FilesWatch {
+		stopWatch, err := api.WatchStore(store, cache, broadcaster)
+		if err != nil {
+			log.Fatalf("[startup] Failed to watch storage for changes: %v", err)
+		}
+		defer stopWatch()
+	}
+
+	// Write every change to a directory of Markdown files as well.
+	var mirror *storage.Mirror
+	if cfg.MirrorDir != "" {
+		mirror, err = storage.NewMirror(store, cfg.MirrorDir)
+		if err != nil {
+			log.Fatalf("[startup] Failed to mirror pads: %v", err)
+		}
+		log.Printf("[startup] Mirroring pads to %s", cfg.MirrorDir)
+
+		if cfg.FilesWatch {
+			stopWatch, err := api.WatchMirror(mirror, store, cache, broadcaster)
+			if err != nil {
+				log.Fatalf("[startup] Failed to watch mirror for changes: %v", err)
+			}
+			defer stopWatch()
+		}
+	}
+
+	// Load the access rules.
+	accessControl, err := access.NewController(store, cfg.AdminToken)
+	if err != nil {
+		log.Fatalf("[startup] Failed to load access rules: %v", err)
+	}
+	defer accessControl.Close()
+
+	// Put single sign-on in front of the routes if configured.
+	var sso func(http.Handler) http.Handler
+	switch cfg.AuthMode {
+	case "":
+	case "oidc":
+		oidc, err := auth.NewOIDC(context.Background(), cfg, accessControl.Authenticated)
+		if err != nil {
+			log.Fatalf("[startup] Failed to set up single sign-on: %v", err)
+		}
+		sso = oidc.Handler
+		log.Printf("[startup] Single sign-on through %s", cfg.OIDCIssuer)
+	default:
+		log.Fatalf("[startup] Unknown PATHPAD_AUTH_MODE %q", cfg.AuthMode)
+	}
 
 	// Build router with all routes, middleware, and embedded static files.
-	router := api.NewRouter(cfg, store, cache, broadcaster, web.StaticFiles)
+	router := api.NewRouter(cfg, store, cache, broadcaster, accessControl, mirror, sso, web.StaticFiles)
 
 	// Create HTTP server.
 	srv := &http.Server{
@@ -73,3 +138,67 @@ func main() {
 
 	log.Println("[shutdown] Server stopped")
 }
+
+// openStore opens the storage backend selected by PATHPAD_STORAGE.
+func openStore(cfg *config.Config) (storage.Store, error) {
+	switch cfg.Storage {
+	case "sqlite":
+		log.Printf("[startup] DB path: %s", cfg.DBPath)
+		store, err := storage.NewSQLiteStore(cfg.DBPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// Apply revision history and trash retention and prune periodically so
+		// pads that are no longer edited don't keep stale revisions forever.
+		store.SetRevisionRetention(cfg.HistoryMaxRevisions, cfg.HistoryMaxAge)
+		store.SetTrashRetention(cfg.TrashRetention)
+		go func() {
+			ticker := time.NewTicker(1 * time.Hour)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := store.PruneRevisions(); err != nil {
+					log.Printf("[db] Failed to prune revisions: %v", err)
+				}
+				if err := store.PurgeTrash(); err != nil {
+					log.Printf("[db] Failed to purge trash: %v", err)
+				}
+			}
+		}()
+
+		if cfg.BackupDir != "" && cfg.BackupInterval > 0 {
+			log.Printf("[startup] Backing up every %s to %s, keeping %d", cfg.BackupInterval, cfg.BackupDir, cfg.BackupKeep)
+			go func() {
+				ticker := time.NewTicker(cfg.BackupInterval)
+				defer ticker.Stop()
+				for range ticker.C {
+					path, err := store.BackupToDir(cfg.BackupDir, cfg.BackupKeep)
+					if err != nil {
+						log.Printf("[db] Scheduled backup failed: %v", err)
+						continue
+					}
+					log.Printf("[db] Backed up to %s", path)
+				}
+			}()
+		}
+		return store, nil
+
+	case "postgres":
+		if cfg.PostgresDSN == "" {
+			return nil, fmt.Errorf("PATHPAD_POSTGRES_DSN is required for the postgres backend")
+		}
+		log.Printf("[startup] Using PostgreSQL storage")
+		return storage.NewPostgresStore(cfg.PostgresDSN)
+
+	case "files":
+		log.Printf("[startup] Storing pads as files in %s", cfg.FilesDir)
+		return storage.NewFileStore(cfg.FilesDir)
+
+	case "memory":
+		log.Printf("[startup] Using in-memory storage; pads are lost on restart")
+		return storage.NewMemoryStore(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected sqlite, postgres, files or memory)", cfg.Storage)
+	}
+}
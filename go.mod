@@ -3,6 +3,16 @@ module pathpad
 go 1.23.6
 
 require (
+	github.com/coreos/go-oidc/v3 v3.14.1
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/go-chi/chi/v5 v5.2.5
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/crypto v0.36.0
+	golang.org/x/oauth2 v0.28.0
+)
+
+require (
+	github.com/go-jose/go-jose/v4 v4.0.5 // indirect
+	golang.org/x/sys v0.31.0 // indirect
 )
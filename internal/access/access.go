@@ -0,0 +1,498 @@
+// Package access decides what a request may do with a pad. Access rules
+// make subtrees read-only or private for anonymous clients, and password
+// locks hide subtrees until they are unlocked; bearer tokens and signed
+// share links grant read or write access to a subtree on top of that. API
+// keys instead confine scripts to their subtree and scopes.
+package access
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pathpad/internal/models"
+	"pathpad/internal/storage"
+)
+
+// Level is what a client may do with a pad.
+type Level int
+
+// Access levels, each including the ones before it.
+const (
+	None Level = iota
+	Read
+	Write
+)
+
+// ParseLevel parses models.AccessRead or models.AccessWrite.
+func ParseLevel(access string) (Level, bool) {
+	switch access {
+	case models.AccessRead:
+		return Read, true
+	case models.AccessWrite:
+		return Write, true
+	}
+	return None, false
+}
+
+// String returns the level's name: "none", "read" or "write".
+func (l Level) String() string {
+	switch l {
+	case Read:
+		return models.AccessRead
+	case Write:
+		return models.AccessWrite
+	}
+	return "none"
+}
+
+// modeLevel is what anonymous clients may do under a rule's mode.
+func modeLevel(mode string) Level {
+	switch mode {
+	case models.ModePrivate:
+		return None
+	case models.ModeReadOnly:
+		return Read
+	}
+	return Write
+}
+
+// ErrInvalidToken is returned for a bearer token or share link that is
+// unknown, expired or tampered with.
+var ErrInvalidToken = errors.New("invalid or expired access token")
+
+// Prefixes telling stored tokens, API keys and share links apart.
+const (
+	tokenPrefix  = "pp_"
+	apiKeyPrefix = "pk_"
+	sharePrefix  = "ps_"
+)
+
+// shareSecretSetting is the setting holding the key share links are signed
+// with.
+const shareSecretSetting = "share_secret"
+
+// Grant gives a level of access to the subtree rooted at Prefix.
+type Grant struct {
+	Prefix string
+	Level  Level
+}
+
+// Grants are the grants a request carries.
+type Grants struct {
+	grants   []Grant
+	unlocked []string       // prefixes of the password locks the client unlocked
+	key      *models.APIKey // the API key the request carried, if any
+	admin    bool           // the request carried the admin token
+
+	// Authenticated is set when the request carried a valid credential.
+	Authenticated bool
+	// TokenName is the name of the access token the request carried, if any.
+	TokenName string
+}
+
+// Controller checks requests against the access rules, which it keeps in
+// memory.
+type Controller struct {
+	store      storage.AccessStore // nil if the backend doesn't support access control
+	adminToken string
+	stopWatch  func() error // stops watching for changes made by other servers
+
+	mu           sync.RWMutex
+	rules        []models.AccessRule // longest prefix first
+	locks        []models.PadLock    // longest prefix first
+	secret       []byte              // signs share links
+	unlockSecret []byte              // signs unlock cookies
+}
+
+// NewController loads the access rules of store. Backends without access
+// control support leave every pad public, so an admin token, which is what
+// manages access control, is refused for them. The admin token, if set,
+// grants write access to everything. Stores shared with other servers are
+// watched, so changes made through any of them take effect everywhere.
+func NewController(store storage.Store, adminToken string) (*Controller, error) {
+	c := &Controller{adminToken: adminToken}
+	if accessStore, ok := store.(storage.AccessStore); ok {
+		c.store = accessStore
+	} else if adminToken != "" {
+		return nil, errors.New("access control is not supported by this storage backend; unset PATHPAD_ADMIN_TOKEN or use SQLite or PostgreSQL")
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	if watcher, ok := store.(storage.AccessWatcher); ok {
+		stop, err := watcher.WatchAccess(func() {
+			if err := c.Reload(); err != nil {
+				log.Printf("[db] Failed to reload access rules: %v", err)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.stopWatch = stop
+	}
+	return c, nil
+}
+
+// Close stops watching the store for changes.
+func (c *Controller) Close() error {
+	if c.stopWatch == nil {
+		return nil
+	}
+	return c.stopWatch()
+}
+
+// Supported reports whether the storage backend supports access control.
+func (c *Controller) Supported() bool {
+	return c.store != nil
+}
+
+// Reload reads the access rules, password locks and signing keys from the
+// store.
+func (c *Controller) Reload() error {
+	if c.store == nil {
+		return nil
+	}
+
+	rules, err := c.store.ListAccessRules()
+	if err != nil {
+		return err
+	}
+	sort.Slice(rules, func(i, j int) bool { return len(rules[i].Prefix) > len(rules[j].Prefix) })
+
+	locks, err := c.store.ListPadLocks()
+	if err != nil {
+		return err
+	}
+	sort.Slice(locks, func(i, j int) bool { return len(locks[i].Prefix) > len(locks[j].Prefix) })
+
+	secret, err := c.loadSecret(shareSecretSetting)
+	if err != nil {
+		return err
+	}
+	unlockSecret, err := c.loadSecret(unlockSecretSetting)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.rules = rules
+	c.locks = locks
+	c.secret = secret
+	c.unlockSecret = unlockSecret
+	c.mu.Unlock()
+	return nil
+}
+
+// loadSecret returns the signing key stored in a setting, creating it on
+// first use.
+func (c *Controller) loadSecret(setting string) ([]byte, error) {
+	value, err := c.store.Setting(setting)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return c.rotateSecret(setting)
+	}
+	return hex.DecodeString(value)
+}
+
+func (c *Controller) rotateSecret(setting string) ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := c.store.SetSetting(setting, hex.EncodeToString(secret)); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// RevokeShareLinks invalidates every share link issued so far by replacing
+// the key they were signed with.
+func (c *Controller) RevokeShareLinks() error {
+	secret, err := c.rotateSecret(shareSecretSetting)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.secret = secret
+	c.mu.Unlock()
+	return nil
+}
+
+// Level returns what the holder of grants may do with the pad at path.
+func (c *Controller) Level(path string, grants Grants) Level {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.level(path, grants)
+}
+
+func (c *Controller) level(path string, grants Grants) Level {
+	level := c.grantedLevel(path, grants)
+	// Only the password opens a lock; grants don't, except the admin token's.
+	if !grants.admin && c.lockedBy(path, grants) != "" {
+		return None
+	}
+	return level
+}
+
+// grantedLevel is what the rules and grants allow with the pad at path,
+// before password locks are considered.
+func (c *Controller) grantedLevel(path string, grants Grants) Level {
+	// API keys reach their own subtree and nothing else, regardless of the
+	// rules.
+	if grants.key != nil {
+		if !inSubtree(path, grants.key.Prefix) {
+			return None
+		}
+		return keyLevel(grants.key)
+	}
+
+	level := Write
+	for _, rule := range c.rules {
+		if inSubtree(path, rule.Prefix) {
+			level = modeLevel(rule.Mode)
+			break
+		}
+	}
+	for _, grant := range grants.grants {
+		if grant.Level > level && inSubtree(path, grant.Prefix) {
+			level = grant.Level
+		}
+	}
+	return level
+}
+
+// SubtreeLevel returns what the holder of grants may do with every pad in
+// the subtree rooted at path, which is the least they may do with any one
+// of them. Access only changes where a rule, lock or grant starts, so
+// checking the root and those places is enough.
+func (c *Controller) SubtreeLevel(path string, grants Grants) Level {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	level := c.level(path, grants)
+	for _, rule := range c.rules {
+		if rule.Prefix != path && inSubtree(rule.Prefix, path) {
+			level = min(level, c.level(rule.Prefix, grants))
+		}
+	}
+	for _, lock := range c.locks {
+		if lock.Prefix != path && inSubtree(lock.Prefix, path) {
+			level = min(level, c.level(lock.Prefix, grants))
+		}
+	}
+	for _, grant := range grants.grants {
+		if grant.Prefix != path && inSubtree(grant.Prefix, path) {
+			level = min(level, c.level(grant.Prefix, grants))
+		}
+	}
+	return level
+}
+
+// inSubtree reports whether p is root or one of its descendants.
+func inSubtree(p, root string) bool {
+	return root == "" || p == root || strings.HasPrefix(p, root+"/")
+}
+
+// Authenticate returns the grants of the credential a request carries,
+// either as a bearer token in the Authorization header or, for clients that
+// can't set headers such as EventSource, in the access_token query
+// parameter. Requests without a credential get no grants; an invalid one is
+// an error. The password locks unlocked by the request's unlock cookie are
+// included either way.
+func (c *Controller) Authenticate(r *http.Request) (Grants, error) {
+	grants := Grants{unlocked: c.unlocked(r)}
+
+	credential := requestCredential(r)
+	if credential == "" {
+		return grants, nil
+	}
+
+	var grant Grant
+	switch {
+	case c.adminToken != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(c.adminToken)) == 1:
+		grant = Grant{Prefix: "", Level: Write}
+		grants.admin = true
+
+	case strings.HasPrefix(credential, sharePrefix):
+		var err error
+		if grant, err = c.verifyShareLink(credential); err != nil {
+			return Grants{}, err
+		}
+
+	case strings.HasPrefix(credential, apiKeyPrefix):
+		key := APIKeyFromContext(r.Context())
+		if key == nil {
+			var err error
+			if key, err = c.lookupAPIKey(credential); err != nil {
+				return Grants{}, err
+			}
+		}
+		grants.key = key
+		grants.Authenticated = true
+		return grants, nil
+
+	case strings.HasPrefix(credential, tokenPrefix) && c.store != nil:
+		token, err := c.store.LookupAccessToken(hashToken(credential))
+		if err != nil {
+			return Grants{}, err
+		}
+		if token == nil {
+			return Grants{}, ErrInvalidToken
+		}
+		level, _ := ParseLevel(token.Access)
+		grant = Grant{Prefix: token.Prefix, Level: level}
+		grants.TokenName = token.Name
+
+	default:
+		return Grants{}, ErrInvalidToken
+	}
+
+	grants.grants = []Grant{grant}
+	grants.Authenticated = true
+	return grants, nil
+}
+
+// Authenticated reports whether a request carries a valid credential.
+func (c *Controller) Authenticated(r *http.Request) bool {
+	grants, err := c.Authenticate(r)
+	return err == nil && grants.Authenticated
+}
+
+// requestCredential returns the credential a request carries, either as a
+// bearer token in the Authorization header or in the access_token query
+// parameter, or "" if there is none.
+func requestCredential(r *http.Request) string {
+	credential, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		credential = r.URL.Query().Get("access_token")
+	}
+	return credential
+}
+
+// NewToken returns a new random bearer token and the hash it is stored
+// under.
+func NewToken() (token, hash string, err error) {
+	return newSecret(tokenPrefix)
+}
+
+// newSecret returns a new random credential starting with prefix and the
+// hash it is stored under.
+func newSecret(prefix string) (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashToken(secret), nil
+}
+
+// hashToken returns the hash a bearer token or API key is stored under.
+// They are random, so a plain SHA-256 is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ShareLink returns a signed credential granting level on the subtree at
+// prefix until expires. Share links aren't stored; they stay valid until
+// they expire or RevokeShareLinks is called.
+func (c *Controller) ShareLink(prefix string, level Level, expires time.Time) (string, error) {
+	if c.store == nil {
+		return "", errors.New("share links are not supported by this storage backend")
+	}
+	payload := strings.Join([]string{prefix, level.String(), strconv.FormatInt(expires.Unix(), 10)}, "\n")
+
+	c.mu.RLock()
+	sig := sign(c.secret, payload)
+	c.mu.RUnlock()
+
+	return sharePrefix + base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sig, nil
+}
+
+func (c *Controller) verifyShareLink(link string) (Grant, error) {
+	encoded, sig, ok := strings.Cut(strings.TrimPrefix(link, sharePrefix), ".")
+	if !ok {
+		return Grant{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Grant{}, ErrInvalidToken
+	}
+
+	c.mu.RLock()
+	valid := c.secret != nil && hmac.Equal([]byte(sig), []byte(sign(c.secret, string(payload))))
+	c.mu.RUnlock()
+	if !valid {
+		return Grant{}, ErrInvalidToken
+	}
+
+	fields := strings.Split(string(payload), "\n")
+	if len(fields) != 3 {
+		return Grant{}, ErrInvalidToken
+	}
+	level, ok := ParseLevel(fields[1])
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if !ok || err != nil || time.Now().Unix() >= expires {
+		return Grant{}, ErrInvalidToken
+	}
+	return Grant{Prefix: fields[0], Level: level}, nil
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type grantsKey struct{}
+
+// Middleware authenticates each request and stores its grants in the
+// request context for FromContext. Requests with an invalid credential are
+// rejected.
+func (c *Controller) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grants, err := c.Authenticate(r)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), grantsKey{}, grants)))
+	})
+}
+
+// writeAuthError writes the response for a request whose credential
+// couldn't be checked.
+func writeAuthError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, ErrInvalidToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid or expired access token"}`))
+		return
+	}
+	log.Printf("[http] Failed to check access token: %v", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(`{"error":"failed to check access token"}`))
+}
+
+// FromContext returns the grants Middleware stored in ctx.
+func FromContext(ctx context.Context) Grants {
+	grants, _ := ctx.Value(grantsKey{}).(Grants)
+	return grants
+}
@@ -0,0 +1,321 @@
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pathpad/internal/models"
+	"pathpad/internal/storage"
+)
+
+const testAdminToken = "admin-secret"
+
+// fakeStore keeps access control state in memory. Methods the tests don't
+// need panic through the nil embedded interface.
+type fakeStore struct {
+	storage.AccessStore
+	rules    []models.AccessRule
+	locks    []models.PadLock
+	tokens   map[string]*models.AccessToken // by hash
+	keys     map[string]*models.APIKey      // by hash
+	settings map[string]string
+}
+
+func (s *fakeStore) ListAccessRules() ([]models.AccessRule, error) {
+	return append([]models.AccessRule(nil), s.rules...), nil
+}
+
+func (s *fakeStore) ListPadLocks() ([]models.PadLock, error) {
+	return append([]models.PadLock(nil), s.locks...), nil
+}
+
+func (s *fakeStore) LookupAccessToken(hash string) (*models.AccessToken, error) {
+	return s.tokens[hash], nil
+}
+
+func (s *fakeStore) LookupAPIKey(hash string) (*models.APIKey, error) {
+	return s.keys[hash], nil
+}
+
+func (s *fakeStore) Setting(key string) (string, error) {
+	return s.settings[key], nil
+}
+
+func (s *fakeStore) SetSetting(key, value string) error {
+	s.settings[key] = value
+	return nil
+}
+
+// newTestController returns a controller with the given rules, given as
+// prefix and mode pairs, and password locks, given as prefix and password
+// pairs.
+func newTestController(t *testing.T, rules, locks []string) (*Controller, *fakeStore) {
+	t.Helper()
+	store := &fakeStore{
+		tokens:   map[string]*models.AccessToken{},
+		keys:     map[string]*models.APIKey{},
+		settings: map[string]string{},
+	}
+	for i := 0; i < len(rules); i += 2 {
+		store.rules = append(store.rules, models.AccessRule{Prefix: rules[i], Mode: rules[i+1]})
+	}
+	for i := 0; i < len(locks); i += 2 {
+		hash, err := HashPassword(locks[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.locks = append(store.locks, models.PadLock{Prefix: locks[i], Hash: hash})
+	}
+	c := &Controller{store: store, adminToken: testAdminToken}
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return c, store
+}
+
+// authenticate returns the grants of a request carrying credential and
+// cookies.
+func authenticate(t *testing.T, c *Controller, credential string, cookies ...*http.Cookie) Grants {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if credential != "" {
+		r.Header.Set("Authorization", "Bearer "+credential)
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	grants, err := c.Authenticate(r)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return grants
+}
+
+func shareLink(t *testing.T, c *Controller, prefix string, level Level) string {
+	t.Helper()
+	link, err := c.ShareLink(prefix, level, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link
+}
+
+func TestLocksNotOpenedByGrants(t *testing.T) {
+	c, store := newTestController(t,
+		[]string{"", models.ModePrivate},
+		[]string{"private", "hunter2"},
+	)
+
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.tokens[hash] = &models.AccessToken{Prefix: "", Access: models.AccessWrite}
+	key, keyHash, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.keys[keyHash] = &models.APIKey{Prefix: "private", Scopes: []string{models.ScopeWrite}}
+
+	for _, tt := range []struct {
+		name       string
+		credential string
+		notes      Level // level on an unlocked pad
+	}{
+		{"share link on root", shareLink(t, c, "", Read), Read},
+		{"share link on lock", shareLink(t, c, "private", Write), None},
+		{"access token on root", token, Write},
+		{"API key on lock", key, None},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			grants := authenticate(t, c, tt.credential)
+			if got := c.Level("notes", grants); got != tt.notes {
+				t.Errorf("Level(notes) = %v, want %v", got, tt.notes)
+			}
+			for _, path := range []string{"private", "private/salaries"} {
+				if got := c.Level(path, grants); got != None {
+					t.Errorf("Level(%s) = %v without unlocking, want none", path, got)
+				}
+				if got := c.LockedBy(path, grants); got != "private" {
+					t.Errorf("LockedBy(%s) = %q, want private", path, got)
+				}
+			}
+			if got := c.SubtreeLevel("", grants); got != None {
+				t.Errorf("SubtreeLevel(root) = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	c, _ := newTestController(t,
+		[]string{"", models.ModePrivate},
+		[]string{"private", "hunter2", "private/inner", "swordfish"},
+	)
+	link := shareLink(t, c, "", Read)
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	if _, _, err := c.Unlock(r, "private", "wrong", time.Hour); err != ErrWrongPassword {
+		t.Fatalf("Unlock with wrong password: %v, want ErrWrongPassword", err)
+	}
+	if _, _, err := c.Unlock(r, "notes", "hunter2", time.Hour); err != ErrNotLocked {
+		t.Fatalf("Unlock of unlocked pad: %v, want ErrNotLocked", err)
+	}
+
+	cookie, unlocked, err := c.Unlock(r, "private", "hunter2", time.Hour)
+	if err != nil || len(unlocked) != 1 || unlocked[0] != "private" {
+		t.Fatalf("Unlock = %v, %v", unlocked, err)
+	}
+	grants := authenticate(t, c, link, cookie)
+	if got := c.Level("private", grants); got != Read {
+		t.Errorf("Level(private) after unlocking = %v, want read", got)
+	}
+	if got := c.Level("private/inner", grants); got != None {
+		t.Errorf("Level(private/inner) = %v, want none until its own lock is opened", got)
+	}
+
+	// Without the share link the private rule still applies.
+	if got := c.Level("private", authenticate(t, c, "", cookie)); got != None {
+		t.Errorf("Level(private) unlocked but without a grant = %v, want none", got)
+	}
+}
+
+func TestAdminTokenOpensLocks(t *testing.T) {
+	c, _ := newTestController(t, nil, []string{"private", "hunter2"})
+	grants := authenticate(t, c, testAdminToken)
+	if got := c.Level("private/x", grants); got != Write {
+		t.Errorf("Level(private/x) = %v, want write", got)
+	}
+	if got := c.SubtreeLockedBy("", grants); got != "" {
+		t.Errorf("SubtreeLockedBy(root) = %q, want none", got)
+	}
+}
+
+// testRules are the access rules of the level tests.
+var testRules = []string{
+	"team", models.ModePrivate,
+	"team/public", models.ModePublic,
+	"docs", models.ModeReadOnly,
+}
+
+func TestLevel(t *testing.T) {
+	c, _ := newTestController(t, testRules, nil)
+
+	anonymous := Grants{}
+	readTeam := Grants{grants: []Grant{{Prefix: "team", Level: Read}}, Authenticated: true}
+	writeDocs := Grants{grants: []Grant{{Prefix: "docs", Level: Write}}, Authenticated: true}
+	readAll := Grants{grants: []Grant{{Prefix: "", Level: Read}}, Authenticated: true}
+	key := Grants{key: &models.APIKey{Prefix: "docs", Scopes: []string{models.ScopeRead}}, Authenticated: true}
+
+	tests := []struct {
+		name   string
+		grants Grants
+		path   string
+		want   Level
+	}{
+		{"no rule", anonymous, "notes", Write},
+		{"root without rule", anonymous, "", Write},
+		{"private rule", anonymous, "team", None},
+		{"private rule below", anonymous, "team/plan", None},
+		{"longer prefix wins", anonymous, "team/public/faq", Write},
+		{"prefix is a whole segment", anonymous, "teamwork", Write},
+		{"read-only rule", anonymous, "docs/guide", Read},
+		{"grant raises private", readTeam, "team/plan", Read},
+		{"grant doesn't lower public", readTeam, "team/public", Write},
+		{"grant only in its subtree", readTeam, "docs", Read},
+		{"write grant on read-only", writeDocs, "docs/guide", Write},
+		{"root grant", readAll, "team/plan", Read},
+		{"root grant doesn't lower", readAll, "notes", Write},
+		{"API key in its subtree", key, "docs/guide", Read},
+		{"API key ignores rules", key, "docs", Read},
+		{"API key outside its subtree", key, "notes", None},
+		{"API key above its subtree", key, "", None},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Level(tt.path, tt.grants); got != tt.want {
+				t.Errorf("Level(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubtreeLevel(t *testing.T) {
+	c, _ := newTestController(t, testRules, nil)
+
+	anonymous := Grants{}
+	readTeam := Grants{grants: []Grant{{Prefix: "team", Level: Read}}, Authenticated: true}
+	writeTeam := Grants{grants: []Grant{{Prefix: "team", Level: Write}}, Authenticated: true}
+	writeDocs := Grants{grants: []Grant{{Prefix: "docs/guide", Level: Write}}, Authenticated: true}
+
+	tests := []struct {
+		name   string
+		grants Grants
+		path   string
+		want   Level
+	}{
+		{"private subtree below", anonymous, "", None},
+		{"no rules below", anonymous, "notes", Write},
+		{"public subtree", anonymous, "team/public", Write},
+		{"private root with public below", anonymous, "team", None},
+		{"read-only subtree", anonymous, "docs", Read},
+		{"minimum of rule and grant", readTeam, "", Read},
+		{"grant on the root", readTeam, "team", Read},
+		{"write grant", writeTeam, "team", Write},
+		{"write grant and read-only rule", writeTeam, "", Read},
+		{"grant below the root", writeDocs, "docs", Read},
+		{"grant is the root", writeDocs, "docs/guide", Write},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.SubtreeLevel(tt.path, tt.grants); got != tt.want {
+				t.Errorf("SubtreeLevel(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	c, store := newTestController(t, []string{"team", models.ModePrivate}, nil)
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.tokens[hash] = &models.AccessToken{Prefix: "team", Access: models.AccessRead}
+
+	link := shareLink(t, c, "team", Write)
+	tampered := link[:len(link)-2] + "xx"
+	expired, err := c.ShareLink("team", Write, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, credential := range []string{"pp_unknown", "pk_unknown", tampered, expired, "garbage"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+credential)
+		if _, err := c.Authenticate(r); err != ErrInvalidToken {
+			t.Errorf("Authenticate(%.12s…) = %v, want ErrInvalidToken", credential, err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/?access_token="+token, nil)
+	grants, err := c.Authenticate(r)
+	if err != nil || !grants.Authenticated || c.Level("team/x", grants) != Read {
+		t.Errorf("token in query: %+v, %v", grants, err)
+	}
+
+	if grants := authenticate(t, c, ""); grants.Authenticated {
+		t.Error("request without a credential is authenticated")
+	}
+
+	if err := c.RevokeShareLinks(); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+link)
+	if _, err := c.Authenticate(r); err != ErrInvalidToken {
+		t.Errorf("revoked share link: %v, want ErrInvalidToken", err)
+	}
+}
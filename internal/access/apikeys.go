@@ -0,0 +1,77 @@
+package access
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"pathpad/internal/models"
+)
+
+// NewAPIKey returns a new random API key and the hash it is stored under.
+func NewAPIKey() (key, hash string, err error) {
+	return newSecret(apiKeyPrefix)
+}
+
+// keyLevel is what an API key may do with the pads in its subtree. The
+// write scope includes reading.
+func keyLevel(key *models.APIKey) Level {
+	switch {
+	case key.HasScope(models.ScopeWrite):
+		return Write
+	case key.HasScope(models.ScopeRead):
+		return Read
+	}
+	return None
+}
+
+// HasScope reports whether the holder of grants has an API key scope.
+// Requests without an API key aren't limited by scopes, so it only returns
+// false for keys lacking the scope.
+func (g Grants) HasScope(scope string) bool {
+	return g.key == nil || slices.Contains(g.key.Scopes, scope)
+}
+
+func (c *Controller) lookupAPIKey(credential string) (*models.APIKey, error) {
+	if c.store == nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := c.store.LookupAPIKey(hashToken(credential))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+type apiKeyKey struct{}
+
+// APIKeyMiddleware looks up the API key a request carries, if any, and
+// stores it in the request context for APIKeyFromContext, so that rate
+// limiting and the admin API can tell keyed requests apart. Requests with an
+// unknown or expired key are rejected.
+func (c *Controller) APIKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential := requestCredential(r)
+		if !strings.HasPrefix(credential, apiKeyPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, err := c.lookupAPIKey(credential)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+	})
+}
+
+// APIKeyFromContext returns the API key APIKeyMiddleware stored in ctx, or
+// nil if the request didn't carry one.
+func APIKeyFromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyKey{}).(*models.APIKey)
+	return key
+}
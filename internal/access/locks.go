@@ -0,0 +1,250 @@
+package access
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"pathpad/internal/models"
+)
+
+var (
+	// ErrNotLocked is returned when unlocking a pad no password protects.
+	ErrNotLocked = errors.New("pad is not password protected")
+
+	// ErrWrongPassword is returned when unlocking with a password that
+	// matches none of the locks protecting a pad.
+	ErrWrongPassword = errors.New("wrong password")
+)
+
+// UnlockCookie is the cookie listing the password locks a browser unlocked.
+const UnlockCookie = "pathpad_unlock"
+
+// unlockSecretSetting is the setting holding the key unlock cookies are
+// signed with.
+const unlockSecretSetting = "unlock_secret"
+
+// Argon2id parameters for new password hashes, the minimum OWASP recommends.
+// Hashes record their parameters, so changing these doesn't affect existing
+// passwords.
+const (
+	argonTime    = 2
+	argonMemory  = 19 * 1024 // KiB
+	argonThreads = 1
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// HashPassword returns the Argon2id hash of a password in the PHC string
+// format, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// checkPassword reports whether password matches a hash made by
+// HashPassword.
+func checkPassword(encoded, password string) bool {
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 6 || fields[1] != "argon2id" || fields[2] != "v="+strconv.Itoa(argon2.Version) {
+		return false
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// lockedBy returns the prefix of the outermost password lock that keeps the
+// holder of grants from the pad at path, or "" if there is none.
+func (c *Controller) lockedBy(path string, grants Grants) string {
+	if grants.admin {
+		return ""
+	}
+	locked := ""
+	for _, lock := range c.locks {
+		if inSubtree(path, lock.Prefix) && !slices.Contains(grants.unlocked, lock.Prefix) {
+			locked = lock.Prefix
+		}
+	}
+	return locked
+}
+
+// LockedBy returns the prefix of the outermost password lock the holder of
+// grants has to unlock to reach the pad at path, or "" if there is none.
+func (c *Controller) LockedBy(path string, grants Grants) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lockedBy(path, grants)
+}
+
+// SubtreeLockedBy is like LockedBy, but also considers the locks of the
+// pads below path.
+func (c *Controller) SubtreeLockedBy(path string, grants Grants) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if locked := c.lockedBy(path, grants); locked != "" || grants.admin {
+		return locked
+	}
+	for i := len(c.locks) - 1; i >= 0; i-- {
+		lock := c.locks[i]
+		if inSubtree(lock.Prefix, path) && !slices.Contains(grants.unlocked, lock.Prefix) {
+			return lock.Prefix
+		}
+	}
+	return ""
+}
+
+// Unlock checks password against the locks protecting the pad at path and
+// returns an unlock cookie valid for ttl that adds the ones it matches to
+// those the request already unlocked, along with their prefixes. A pad
+// under several locks needs each of their passwords.
+func (c *Controller) Unlock(r *http.Request, path, password string, ttl time.Duration) (*http.Cookie, []string, error) {
+	c.mu.RLock()
+	var locks []models.PadLock
+	for _, lock := range c.locks {
+		if inSubtree(path, lock.Prefix) {
+			locks = append(locks, lock)
+		}
+	}
+	c.mu.RUnlock()
+	if len(locks) == 0 {
+		return nil, nil, ErrNotLocked
+	}
+
+	// Hashing is slow on purpose, so don't hold the lock meanwhile.
+	var matched []string
+	for _, lock := range locks {
+		if checkPassword(lock.Hash, password) {
+			matched = append(matched, lock.Prefix)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil, ErrWrongPassword
+	}
+
+	expires := time.Now().Add(ttl)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var entries []string
+	for _, prefix := range c.unlockedPrefixes(r) {
+		if !slices.Contains(matched, prefix) {
+			entries = append(entries, c.unlockEntry(prefix, expires))
+		}
+	}
+	for _, prefix := range matched {
+		entries = append(entries, c.unlockEntry(prefix, expires))
+	}
+
+	cookie := &http.Cookie{
+		Name:     UnlockCookie,
+		Value:    strings.Join(entries, "|"),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	return cookie, matched, nil
+}
+
+// unlocked returns the prefixes of the password locks the request's unlock
+// cookie validly unlocks.
+func (c *Controller) unlocked(r *http.Request) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.unlockedPrefixes(r)
+}
+
+// unlockedPrefixes is unlocked for callers already holding c.mu.
+func (c *Controller) unlockedPrefixes(r *http.Request) []string {
+	if len(c.locks) == 0 {
+		return nil
+	}
+	cookie, err := r.Cookie(UnlockCookie)
+	if err != nil {
+		return nil
+	}
+
+	var prefixes []string
+	for _, entry := range strings.Split(cookie.Value, "|") {
+		if prefix, ok := c.verifyUnlockEntry(entry); ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// unlockEntry returns the cookie entry unlocking the lock at prefix until
+// expires. The signature covers the lock's password hash, so changing or
+// removing the password invalidates the entry.
+func (c *Controller) unlockEntry(prefix string, expires time.Time) string {
+	payload := prefix + "\n" + strconv.FormatInt(expires.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sign(c.unlockSecret, payload+"\n"+c.lockHash(prefix))
+}
+
+func (c *Controller) verifyUnlockEntry(entry string) (string, bool) {
+	encoded, sig, ok := strings.Cut(entry, ".")
+	if !ok {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	prefix, expiresField, ok := strings.Cut(string(payload), "\n")
+	if !ok {
+		return "", false
+	}
+	hash := c.lockHash(prefix)
+	if hash == "" || !hmac.Equal([]byte(sig), []byte(sign(c.unlockSecret, string(payload)+"\n"+hash))) {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(expiresField, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return "", false
+	}
+	return prefix, true
+}
+
+// lockHash returns the password hash of the lock at prefix, or "" if there
+// is none.
+func (c *Controller) lockHash(prefix string) string {
+	for _, lock := range c.locks {
+		if lock.Prefix == prefix {
+			return lock.Hash
+		}
+	}
+	return ""
+}
@@ -0,0 +1,599 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"pathpad/internal/access"
+	"pathpad/internal/models"
+	"pathpad/internal/storage"
+)
+
+// authorize checks that the request may access the pad at path at the
+// given level. If not, it writes a 401 or 403 response and returns false.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, path string, need access.Level) bool {
+	grants := access.FromContext(r.Context())
+	if h.Access.Level(path, grants) >= need {
+		return true
+	}
+	denied(w, grants, h.Access.LockedBy(path, grants))
+	return false
+}
+
+// authorizeSubtree is like authorize, but checks every pad in the subtree
+// rooted at path.
+func (h *Handler) authorizeSubtree(w http.ResponseWriter, r *http.Request, path string, need access.Level) bool {
+	grants := access.FromContext(r.Context())
+	if h.Access.SubtreeLevel(path, grants) >= need {
+		return true
+	}
+	denied(w, grants, h.Access.SubtreeLockedBy(path, grants))
+	return false
+}
+
+// canRead reports whether the request may read the pad at path. Listings use
+// it to leave out pads the client can't see.
+func (h *Handler) canRead(r *http.Request, path string) bool {
+	return h.Access.Level(path, access.FromContext(r.Context())) >= access.Read
+}
+
+// requireScope checks that the request's API key, if it carried one, has
+// scope. If not, it writes a 403 response and returns false.
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if access.FromContext(r.Context()).HasScope(scope) {
+		return true
+	}
+	jsonError(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
+	return false
+}
+
+// denied writes the response for a request lacking access: 401 naming the
+// password lock to unlock if one is in the way, 401 asking for a token if it
+// carried none, and 403 otherwise.
+func denied(w http.ResponseWriter, grants access.Grants, locked string) {
+	if locked != "" {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "pad is password protected",
+			"lock":  locked,
+		})
+		return
+	}
+	if !grants.Authenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pathpad"`)
+		jsonError(w, http.StatusUnauthorized, "an access token is required")
+		return
+	}
+	jsonError(w, http.StatusForbidden, "access denied")
+}
+
+// ListAccessRules handles GET /api/admin/rules
+func (h *Handler) ListAccessRules(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "access control")
+		return
+	}
+
+	rules, err := accessStore.ListAccessRules()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list access rules")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"rules": rules})
+}
+
+// SetAccessRule handles PUT /api/admin/rules/*
+// Sets the mode of the subtree at the path: "public", "read-only" or "private".
+func (h *Handler) SetAccessRule(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "access control")
+		return
+	}
+
+	prefix := extractPadPath(r, "/api/admin/rules/")
+	if r.URL.Path == "/api/admin/rules" || r.URL.Path == "/api/admin/rules/" {
+		prefix = ""
+	}
+
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if !models.ValidMode(req.Mode) {
+		jsonError(w, http.StatusBadRequest, `mode must be "public", "read-only" or "private"`)
+		return
+	}
+
+	rule, err := accessStore.SetAccessRule(prefix, req.Mode)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to set access rule")
+		return
+	}
+	if !h.reloadAccess(w) {
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, rule)
+}
+
+// DeleteAccessRule handles DELETE /api/admin/rules/*
+// Removes the rule for the path, so the subtree inherits its parent's mode.
+func (h *Handler) DeleteAccessRule(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "access control")
+		return
+	}
+
+	prefix := extractPadPath(r, "/api/admin/rules/")
+	if r.URL.Path == "/api/admin/rules" || r.URL.Path == "/api/admin/rules/" {
+		prefix = ""
+	}
+
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := accessStore.DeleteAccessRule(prefix)
+	if errors.Is(err, storage.ErrRuleNotFound) {
+		jsonError(w, http.StatusNotFound, "access rule not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to delete access rule")
+		return
+	}
+	if !h.reloadAccess(w) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reloadAccess makes changed access rules take effect.
+func (h *Handler) reloadAccess(w http.ResponseWriter) bool {
+	if err := h.Access.Reload(); err != nil {
+		log.Printf("[http] Failed to reload access rules: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to reload access rules")
+		return false
+	}
+	return true
+}
+
+// ListAccessTokens handles GET /api/admin/tokens
+func (h *Handler) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "access control")
+		return
+	}
+
+	tokens, err := accessStore.ListAccessTokens()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list access tokens")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"tokens": tokens})
+}
+
+// CreateAccessToken handles POST /api/admin/tokens
+// Creates a bearer token for a subtree. The token is only returned here.
+func (h *Handler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "access control")
+		return
+	}
+
+	var req struct {
+		Name          string `json:"name"`
+		Prefix        string `json:"prefix"`
+		Access        string `json:"access"`
+		ExpiresInDays int    `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	prefix := models.NormalizePath(req.Prefix)
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !models.ValidAccess(req.Access) {
+		jsonError(w, http.StatusBadRequest, `access must be "read" or "write"`)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		jsonError(w, http.StatusBadRequest, "expires_in_days must not be negative")
+		return
+	}
+
+	secret, hash, err := access.NewToken()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create access token")
+		return
+	}
+	token := &models.AccessToken{Name: req.Name, Prefix: prefix, Access: req.Access}
+	if req.ExpiresInDays > 0 {
+		token.ExpiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays).Unix()
+	}
+	if err := accessStore.CreateAccessToken(token, hash); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create access token")
+		return
+	}
+	token.Token = secret
+
+	jsonResponse(w, http.StatusCreated, token)
+}
+
+// DeleteAccessToken handles DELETE /api/admin/tokens/{id}
+func (h *Handler) DeleteAccessToken(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "access control")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		jsonError(w, http.StatusBadRequest, "id must be a positive integer")
+		return
+	}
+
+	err = accessStore.DeleteAccessToken(id)
+	if errors.Is(err, storage.ErrTokenNotFound) {
+		jsonError(w, http.StatusNotFound, "access token not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to delete access token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAPIKeys handles GET /api/admin/keys
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "API keys")
+		return
+	}
+
+	keys, err := accessStore.ListAPIKeys()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list API keys")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// CreateAPIKey handles POST /api/admin/keys
+// Creates an API key limited to a subtree and scopes. The key is only
+// returned here.
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "API keys")
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Prefix        string   `json:"prefix"`
+		Scopes        []string `json:"scopes"`
+		RateLimit     int      `json:"rate_limit"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	prefix := models.NormalizePath(req.Prefix)
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Scopes) == 0 {
+		jsonError(w, http.StatusBadRequest, "scopes is required")
+		return
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !models.ValidScope(scope) {
+			jsonError(w, http.StatusBadRequest, `scopes must be "read", "write", "delete" or "admin"`)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	// The admin API manages the whole tree, so it can't be confined to a
+	// subtree.
+	if slices.Contains(scopes, models.ScopeAdmin) && prefix != "" {
+		jsonError(w, http.StatusBadRequest, "keys with the admin scope must have the root prefix")
+		return
+	}
+	if req.RateLimit < 0 {
+		jsonError(w, http.StatusBadRequest, "rate_limit must not be negative")
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		jsonError(w, http.StatusBadRequest, "expires_in_days must not be negative")
+		return
+	}
+
+	secret, hash, err := access.NewAPIKey()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create API key")
+		return
+	}
+	key := &models.APIKey{Name: req.Name, Prefix: prefix, Scopes: scopes, RateLimit: req.RateLimit}
+	if req.ExpiresInDays > 0 {
+		key.ExpiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays).Unix()
+	}
+	if err := accessStore.CreateAPIKey(key, hash); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create API key")
+		return
+	}
+	key.Key = secret
+
+	jsonResponse(w, http.StatusCreated, key)
+}
+
+// DeleteAPIKey handles DELETE /api/admin/keys/{id}
+func (h *Handler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "API keys")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		jsonError(w, http.StatusBadRequest, "id must be a positive integer")
+		return
+	}
+
+	err = accessStore.DeleteAPIKey(id)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		jsonError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to delete API key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateShareLink handles POST /api/admin/share-links
+// Returns a signed link granting access to a subtree until it expires.
+func (h *Handler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	if !h.Access.Supported() {
+		notSupported(w, "access control")
+		return
+	}
+
+	var req struct {
+		Prefix         string `json:"prefix"`
+		Access         string `json:"access"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	prefix := models.NormalizePath(req.Prefix)
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	level, ok := access.ParseLevel(req.Access)
+	if !ok {
+		jsonError(w, http.StatusBadRequest, `access must be "read" or "write"`)
+		return
+	}
+	if req.ExpiresInHours < 0 {
+		jsonError(w, http.StatusBadRequest, "expires_in_hours must not be negative")
+		return
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = 7 * 24
+	}
+
+	expires := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+	token, err := h.Access.ShareLink(prefix, level, expires)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create share link")
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, map[string]interface{}{
+		"token":      token,
+		"url":        "/" + prefix + "?access_token=" + url.QueryEscape(token),
+		"expires_at": expires.Unix(),
+	})
+}
+
+// RevokeShareLinks handles DELETE /api/admin/share-links
+// Invalidates every share link issued so far.
+func (h *Handler) RevokeShareLinks(w http.ResponseWriter, r *http.Request) {
+	if !h.Access.Supported() {
+		notSupported(w, "access control")
+		return
+	}
+
+	if err := h.Access.RevokeShareLinks(); err != nil {
+		log.Printf("[http] Failed to revoke share links: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to revoke share links")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockPad handles POST /api/pad/unlock/*
+// Checks the password of the locks protecting the pad and sets a cookie
+// unlocking the ones it matches.
+func (h *Handler) UnlockPad(w http.ResponseWriter, r *http.Request) {
+	path := extractPadPath(r, "/api/pad/unlock/")
+	if r.URL.Path == "/api/pad/unlock" || r.URL.Path == "/api/pad/unlock/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	cookie, unlocked, err := h.Access.Unlock(r, path, req.Password, h.UnlockTTL)
+	switch {
+	case errors.Is(err, access.ErrNotLocked):
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, access.ErrWrongPassword):
+		jsonError(w, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		jsonError(w, http.StatusInternalServerError, "failed to unlock pad")
+		return
+	}
+
+	http.SetCookie(w, cookie)
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"unlocked": unlocked})
+}
+
+// ListPadLocks handles GET /api/admin/locks
+func (h *Handler) ListPadLocks(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "password protection")
+		return
+	}
+
+	locks, err := accessStore.ListPadLocks()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list pad locks")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"locks": locks})
+}
+
+// SetPadLock handles PUT /api/admin/locks/*
+// Protects the subtree at the path with the password in the body, replacing
+// any password it had. Unlock cookies for the old password stop working.
+func (h *Handler) SetPadLock(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "password protection")
+		return
+	}
+
+	prefix := extractPadPath(r, "/api/admin/locks/")
+	if r.URL.Path == "/api/admin/locks" || r.URL.Path == "/api/admin/locks/" {
+		prefix = ""
+	}
+
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Password == "" {
+		jsonError(w, http.StatusBadRequest, "password is required")
+		return
+	}
+
+	hash, err := access.HashPassword(req.Password)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to set password")
+		return
+	}
+	lock, err := accessStore.SetPadLock(prefix, hash)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to set password")
+		return
+	}
+	if !h.reloadAccess(w) {
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, lock)
+}
+
+// DeletePadLock handles DELETE /api/admin/locks/*
+// Removes the password from the subtree at the path.
+func (h *Handler) DeletePadLock(w http.ResponseWriter, r *http.Request) {
+	accessStore, ok := h.Store.(storage.AccessStore)
+	if !ok {
+		notSupported(w, "password protection")
+		return
+	}
+
+	prefix := extractPadPath(r, "/api/admin/locks/")
+	if r.URL.Path == "/api/admin/locks" || r.URL.Path == "/api/admin/locks/" {
+		prefix = ""
+	}
+
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := accessStore.DeletePadLock(prefix)
+	if errors.Is(err, storage.ErrLockNotFound) {
+		jsonError(w, http.StatusNotFound, "pad lock not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to delete pad lock")
+		return
+	}
+	if !h.reloadAccess(w) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
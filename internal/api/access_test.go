@@ -0,0 +1,470 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"pathpad/internal/access"
+	"pathpad/internal/auth"
+	"pathpad/internal/config"
+	"pathpad/internal/models"
+	"pathpad/internal/sse"
+	"pathpad/internal/storage"
+)
+
+const testAdminToken = "admin-secret"
+
+// testConfig returns the configuration of test servers.
+func testConfig() *config.Config {
+	return &config.Config{
+		MaxContentSize:         1 << 20,
+		MaxImportSize:          1 << 20,
+		RateLimit:              10000,
+		CORSOrigins:            "*",
+		DeleteConfirmThreshold: 100,
+		UnlockTTL:              time.Hour,
+		AdminToken:             testAdminToken,
+	}
+}
+
+// newTestServer returns the API of a fresh SQLite store holding pads, given
+// as path and content pairs, under the access rules, given as prefix and
+// mode pairs.
+func newTestServer(t *testing.T, pads, rules []string) (http.Handler, *storage.SQLiteStore) {
+	t.Helper()
+	return newTestServerWithConfig(t, testConfig(), pads, rules)
+}
+
+func newTestServerWithConfig(t *testing.T, cfg *config.Config, pads, rules []string) (http.Handler, *storage.SQLiteStore) {
+	t.Helper()
+	store, err := storage.NewSQLiteStore(filepath.Join(t.TempDir(), "pathpad.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	for i := 0; i < len(pads); i += 2 {
+		if _, err := store.SavePad(pads[i], pads[i+1], ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < len(rules); i += 2 {
+		if _, err := store.SetAccessRule(rules[i], rules[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	controller, err := access.NewController(store, testAdminToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sso func(http.Handler) http.Handler
+	if cfg.AuthMode == "oidc" {
+		oidc, err := auth.NewOIDC(context.Background(), cfg, controller.Authenticated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sso = oidc.Handler
+	}
+	staticFS := fstest.MapFS{"static/index.html": {Data: []byte("<!doctype html>")}}
+	router := NewRouter(cfg, store, storage.NewCache(time.Minute), sse.NewBroadcaster(100, time.Minute), controller, nil, sso, staticFS)
+	return router, store
+}
+
+// oidcTestConfig returns the configuration of test servers behind single
+// sign-on.
+func oidcTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := testConfig()
+	cfg.AuthMode = "oidc"
+	cfg.OIDCIssuer = newTestIssuer(t)
+	cfg.OIDCClientID = "pathpad"
+	cfg.OIDCRedirectURL = "http://pathpad.test/auth/callback"
+	cfg.SessionSecret = "test-secret"
+	cfg.SessionTTL = time.Hour
+	return cfg
+}
+
+// newTestIssuer serves the discovery document of an OpenID Connect provider
+// and returns its issuer URL. Nobody can sign in with it.
+func newTestIssuer(t *testing.T) string {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// do sends a request to h, with credential as a bearer token if it isn't
+// empty.
+func do(h http.Handler, method, target, credential, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if credential != "" {
+		r.Header.Set("Authorization", "Bearer "+credential)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// listedPaths returns the paths of the items in the list under key of a
+// JSON response.
+func listedPaths(t *testing.T, w *httptest.ResponseRecorder, key string) []string {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var body map[string][]struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, item := range body[key] {
+		paths = append(paths, item.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// exportedFiles returns the names of the files in an exported zip archive.
+func exportedFiles(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: status %d: %s", w.Code, w.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// createToken stores an access token and returns its secret.
+func createToken(t *testing.T, store *storage.SQLiteStore, prefix, level string) string {
+	t.Helper()
+	secret, hash, err := access.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAccessToken(&models.AccessToken{Prefix: prefix, Access: level}, hash); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+var privateTestPads = []string{
+	"notes", "needle in notes",
+	"notes/gone", "deleted note",
+	"team", "needle in team",
+	"team/plan", "needle in plan",
+	"team/gone", "deleted plan",
+}
+
+func TestPrivatePadsHidden(t *testing.T) {
+	h, store := newTestServer(t, privateTestPads, []string{"team", models.ModePrivate})
+	for _, path := range []string{"notes/gone", "team/gone"} {
+		if _, err := store.DeletePad(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	teamToken := createToken(t, store, "team", models.AccessRead)
+
+	tests := []struct {
+		name       string
+		credential string
+		children   []string
+		search     []string
+		trash      []string
+		export     []string
+	}{
+		{
+			name:     "anonymous",
+			children: []string{"notes"},
+			search:   []string{"notes"},
+			trash:    []string{"notes/gone"},
+			export:   []string{"manifest.json", "notes.md"},
+		},
+		{
+			name:       "token on private subtree",
+			credential: teamToken,
+			children:   []string{"notes", "team"},
+			search:     []string{"notes", "team", "team/plan"},
+			trash:      []string{"notes/gone", "team/gone"},
+			export:     []string{"manifest.json", "notes.md", "team/index.md", "team/plan.md"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listedPaths(t, do(h, http.MethodGet, "/api/pad/children", tt.credential, ""), "children"); !slices.Equal(got, tt.children) {
+				t.Errorf("children = %v, want %v", got, tt.children)
+			}
+			if got := listedPaths(t, do(h, http.MethodGet, "/api/pad/search?q=needle", tt.credential, ""), "results"); !slices.Equal(got, tt.search) {
+				t.Errorf("search = %v, want %v", got, tt.search)
+			}
+			if got := listedPaths(t, do(h, http.MethodGet, "/api/pad/trash", tt.credential, ""), "trash"); !slices.Equal(got, tt.trash) {
+				t.Errorf("trash = %v, want %v", got, tt.trash)
+			}
+			if got := exportedFiles(t, do(h, http.MethodGet, "/api/pad/export?format=zip", tt.credential, "")); !slices.Equal(got, tt.export) {
+				t.Errorf("export = %v, want %v", got, tt.export)
+			}
+		})
+	}
+}
+
+func TestPrivatePadsDenied(t *testing.T) {
+	h, store := newTestServer(t, privateTestPads, []string{
+		"team", models.ModePrivate,
+		"notes", models.ModeReadOnly,
+	})
+	readToken := createToken(t, store, "", models.AccessRead)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		credential string
+		body       string
+		want       int
+	}{
+		{"read private", http.MethodGet, "/api/pad/content/team/plan", "", "", http.StatusUnauthorized},
+		{"children of private", http.MethodGet, "/api/pad/children/team", "", "", http.StatusUnauthorized},
+		{"export private", http.MethodGet, "/api/pad/export/team", "", "", http.StatusUnauthorized},
+		{"history of private", http.MethodGet, "/api/pad/history/team/plan", "", "", http.StatusUnauthorized},
+		{"subscribe to private", http.MethodGet, "/api/pad/events/team/plan?client_id=a", "", "", http.StatusUnauthorized},
+		{"subscribe to private root", http.MethodGet, "/api/pad/events/team?client_id=a", "", "", http.StatusUnauthorized},
+		{"write read-only", http.MethodPut, "/api/pad/content/notes", "", `{"content":"x"}`, http.StatusUnauthorized},
+		{"write read-only with read token", http.MethodPut, "/api/pad/content/notes", readToken, `{"content":"x"}`, http.StatusForbidden},
+		{"delete subtree with private pads", http.MethodDelete, "/api/pad/content", "", "", http.StatusUnauthorized},
+		{"move private", http.MethodPost, "/api/pad/move/team/plan", "", `{"destination":"plan"}`, http.StatusUnauthorized},
+		{"copy private", http.MethodPost, "/api/pad/copy/team", "", `{"destination":"copy"}`, http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/api/pad/content/notes", "pp_forged", "", http.StatusUnauthorized},
+		{"read read-only", http.MethodGet, "/api/pad/content/notes", "", "", http.StatusOK},
+		{"read private with token", http.MethodGet, "/api/pad/content/team/plan", readToken, "", http.StatusOK},
+		{"admin token", http.MethodPut, "/api/pad/content/team/plan", testAdminToken, `{"content":"x"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(h, tt.method, tt.target, tt.credential, tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestSubscribeWithToken(t *testing.T) {
+	h, store := newTestServer(t, privateTestPads, []string{"team", models.ModePrivate})
+	token := createToken(t, store, "team", models.AccessRead)
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/pad/events/team/plan?client_id=a&access_token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("subscribe with token: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *config.Config
+		anonymous int // status of an anonymous request within the IP's limit
+	}{
+		{"open", testConfig(), http.StatusOK},
+		{"single sign-on", oidcTestConfig(t), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.RateLimit = 3
+			h, store := newTestServerWithConfig(t, tt.cfg, []string{"notes", "hello"}, nil)
+
+			key, hash, err := access.NewAPIKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.CreateAPIKey(&models.APIKey{Name: "ci", Scopes: []string{models.ScopeRead}, RateLimit: 5}, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			get := func(credential string) int {
+				return do(h, http.MethodGet, "/api/pad/content/notes", credential, "").Code
+			}
+
+			// Requests with a valid key count against the key, not the IP.
+			for i := 0; i < 5; i++ {
+				if code := get(key); code != http.StatusOK {
+					t.Fatalf("request %d with key: status %d", i+1, code)
+				}
+			}
+			if code := get(key); code != http.StatusTooManyRequests {
+				t.Errorf("request over the key's limit: status %d", code)
+			}
+
+			// Unknown keys count against the IP, like anonymous requests.
+			if code := get(""); code != tt.anonymous {
+				t.Errorf("anonymous request: status %d, want %d", code, tt.anonymous)
+			}
+			for i := 0; i < 2; i++ {
+				if code := get("pk_guess"); code != http.StatusUnauthorized {
+					t.Errorf("unknown key: status %d", code)
+				}
+			}
+			for _, credential := range []string{"pk_guess", ""} {
+				if code := get(credential); code != http.StatusTooManyRequests {
+					t.Errorf("request %q over the IP's limit: status %d", credential, code)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorNotDeclaredWithCredential(t *testing.T) {
+	h, store := newTestServer(t, nil, nil)
+	secret, hash, err := access.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateAccessToken(&models.AccessToken{Name: "deploy", Prefix: "", Access: models.AccessWrite}, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		credential string
+		want       string
+	}{
+		{"anonymous", "", "mallory"},
+		{"access token", secret, "deploy"},
+		{"admin token", testAdminToken, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(h, http.MethodPut, "/api/pad/content/notes?name=mallory", tt.credential, `{"content":"`+tt.name+`"}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("save: status %d: %s", w.Code, w.Body)
+			}
+			pad, err := store.GetPad("notes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pad.UpdatedBy != tt.want {
+				t.Errorf("updated_by = %q, want %q", pad.UpdatedBy, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportRenameStaysInScope(t *testing.T) {
+	h, store := newTestServer(t, []string{"team", "team", "team/plan", "plan"}, []string{"", models.ModeReadOnly})
+	token := createToken(t, store, "team", models.AccessWrite)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"index.md", "plan.md"} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("imported " + name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := do(h, http.MethodPost, "/api/pad/import/team?on_conflict=rename", token, buf.String())
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body)
+	}
+	pads, err := store.GetSubtree("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, pad := range pads {
+		paths = append(paths, pad.Path)
+	}
+	if want := []string{"team", "team/plan", "team/plan-1"}; !slices.Equal(paths, want) {
+		t.Errorf("pads after import = %v, want %v", paths, want)
+	}
+}
+
+func TestRateLimitBeforeSignIn(t *testing.T) {
+	cfg := oidcTestConfig(t)
+	cfg.RateLimit = 3
+	h, _ := newTestServerWithConfig(t, cfg, []string{"notes", "hello"}, nil)
+
+	// Sign-in looks guessed credentials up, so they count against the IP
+	// before that.
+	for _, credential := range []string{"pp_guess", "pk_guess", "pp_guess"} {
+		if code := do(h, http.MethodGet, "/api/pad/content/notes", credential, "").Code; code != http.StatusUnauthorized {
+			t.Errorf("request %q: status %d, want 401", credential, code)
+		}
+	}
+	for _, credential := range []string{"pp_guess", "pk_guess"} {
+		if code := do(h, http.MethodGet, "/api/pad/content/notes", credential, "").Code; code != http.StatusTooManyRequests {
+			t.Errorf("request %q over the IP's limit: status %d, want 429", credential, code)
+		}
+	}
+}
+
+func TestDeleteConfirmThreshold(t *testing.T) {
+	cfg := testConfig()
+	cfg.DeleteConfirmThreshold = 2
+	h, store := newTestServerWithConfig(t, cfg, []string{
+		"small", "", "small/a", "", "small/a/b", "",
+		"large", "", "large/a", "", "large/b", "", "large/c", "",
+	}, nil)
+
+	if w := do(h, http.MethodDelete, "/api/pad/content/small", "", ""); w.Code != http.StatusOK {
+		t.Errorf("delete pad with 2 descendants: status %d: %s", w.Code, w.Body)
+	}
+	w := do(h, http.MethodDelete, "/api/pad/content/large", "", "")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"count":4`) {
+		t.Fatalf("delete pad with 3 descendants: status %d: %s", w.Code, w.Body)
+	}
+	if w := do(h, http.MethodDelete, "/api/pad/content/large?confirm=4", "", ""); w.Code != http.StatusOK {
+		t.Errorf("confirmed delete: status %d: %s", w.Code, w.Body)
+	}
+	if count, _ := store.CountSubtree(""); count != 0 {
+		t.Errorf("%d pads left", count)
+	}
+}
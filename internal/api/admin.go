@@ -0,0 +1,60 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"pathpad/internal/storage"
+)
+
+// Backup handles GET /api/admin/backup
+// Streams a consistent snapshot of the live database as an SQLite file.
+func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	backuper, ok := h.Store.(storage.Backuper)
+	if !ok {
+		notSupported(w, "backup")
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "pathpad-backup-")
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	backupPath := filepath.Join(dir, "pathpad.db")
+	if err := backuper.Backup(backupPath); err != nil {
+		log.Printf("[db] Backup failed: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+
+	f, err := os.Open(backupPath)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to read backup")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to read backup")
+		return
+	}
+
+	name := "pathpad-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("[http] Sending backup failed: %v", err)
+	}
+}
@@ -2,21 +2,42 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"pathpad/internal/access"
+	"pathpad/internal/archive"
+	"pathpad/internal/auth"
 	"pathpad/internal/models"
+	"pathpad/internal/ot"
 	"pathpad/internal/sse"
 	"pathpad/internal/storage"
 )
 
 // Handler holds dependencies for API handlers.
 type Handler struct {
-	Store          *storage.SQLiteStore
+	Store          storage.Store
 	Cache          *storage.Cache
 	Broadcaster    *sse.Broadcaster
+	Access         *access.Controller
+	OpHistory      *ot.History
 	MaxContentSize int64
+	MaxImportSize  int64
+
+	// How long unlocking a password-protected pad lasts.
+	UnlockTTL time.Duration
+
+	// Descendant count above which DeletePad asks for confirmation.
+	DeleteConfirmThreshold int
+
+	// Directory every change is written to; nil if not mirroring.
+	Mirror *storage.Mirror
 }
 
 // extractPadPath extracts and normalizes the pad path from the URL.
@@ -38,6 +59,64 @@ func jsonError(w http.ResponseWriter, status int, message string) {
 	jsonResponse(w, status, map[string]string{"error": message})
 }
 
+// notSupported writes a 501 response for a feature the storage backend
+// doesn't implement.
+func notSupported(w http.ResponseWriter, feature string) {
+	jsonError(w, http.StatusNotImplemented, feature+" is not supported by this storage backend")
+}
+
+// padETag returns the ETag for a pad, derived from its version.
+func padETag(pad *models.Pad) string {
+	return `"` + strconv.FormatInt(pad.Version, 10) + `"`
+}
+
+// ifMatchVersion parses the If-Match header into an expected pad version.
+// ok is false when the header is absent or "*", meaning no precondition.
+func ifMatchVersion(r *http.Request) (version int64, ok bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+	header = strings.TrimPrefix(header, "W/")
+	version, err = strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil {
+		return 0, false, errors.New("invalid If-Match header")
+	}
+	return version, true, nil
+}
+
+// maxAuthorLength caps self-declared author names, in characters.
+const maxAuthorLength = 64
+
+// author returns the name a change made by r is attributed to: the
+// signed-in user's, the API key's or the access token's, or else the display
+// name the client declared in the name query parameter alongside its
+// client_id. Declared names aren't verified, so requests with a credential
+// can't override its name with one. It returns "" for anonymous changes.
+func author(r *http.Request) string {
+	if id := auth.FromContext(r.Context()); id != nil {
+		return id.Name
+	}
+	if key := access.APIKeyFromContext(r.Context()); key != nil {
+		return key.Name
+	}
+	if grants := access.FromContext(r.Context()); grants.Authenticated {
+		return grants.TokenName
+	}
+	// Control characters become spaces, and runs of whitespace one space.
+	name := strings.Map(func(c rune) rune {
+		if unicode.IsControl(c) {
+			return ' '
+		}
+		return c
+	}, r.URL.Query().Get("name"))
+	name = strings.Join(strings.Fields(name), " ")
+	if runes := []rune(name); len(runes) > maxAuthorLength {
+		name = strings.TrimSpace(string(runes[:maxAuthorLength]))
+	}
+	return name
+}
+
 // GetPad handles GET /api/pad/content/*
 func (h *Handler) GetPad(w http.ResponseWriter, r *http.Request) {
 	path := extractPadPath(r, "/api/pad/content/")
@@ -50,9 +129,14 @@ func (h *Handler) GetPad(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if !h.authorize(w, r, path, access.Read) {
+		return
+	}
+	w.Header().Set("X-Pathpad-Access", h.Access.Level(path, access.FromContext(r.Context())).String())
 
 	// Try cache first.
 	if cached := h.Cache.Get(path); cached != nil {
+		w.Header().Set("ETag", padETag(cached))
 		jsonResponse(w, http.StatusOK, cached)
 		return
 	}
@@ -66,6 +150,7 @@ func (h *Handler) GetPad(w http.ResponseWriter, r *http.Request) {
 	// Cache the result.
 	h.Cache.Set(path, pad)
 
+	w.Header().Set("ETag", padETag(pad))
 	jsonResponse(w, http.StatusOK, pad)
 }
 
@@ -80,6 +165,9 @@ func (h *Handler) SavePad(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if !h.authorize(w, r, path, access.Write) {
+		return
+	}
 
 	// Read and parse request body.
 	body, err := io.ReadAll(io.LimitReader(r.Body, h.MaxContentSize+1))
@@ -100,22 +188,253 @@ func (h *Handler) SavePad(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pad, err := h.Store.SavePad(path, req.Content)
+	// Honor If-Match so concurrent editors don't silently overwrite each other.
+	expectedVersion, conditional, err := ifMatchVersion(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var pad *models.Pad
+	if conditional {
+		pad, err = h.Store.SavePadIfVersion(path, req.Content, expectedVersion, author(r))
+	} else {
+		pad, err = h.Store.SavePad(path, req.Content, author(r))
+	}
+	if errors.Is(err, storage.ErrVersionConflict) {
+		h.versionConflict(w, path)
+		return
+	}
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to save pad")
 		return
 	}
 
+	h.padSaved(path, pad, r.URL.Query().Get("client_id"))
+
+	w.Header().Set("ETag", padETag(pad))
+	jsonResponse(w, http.StatusOK, pad)
+}
+
+// versionConflict writes a 409 response carrying the pad's current content
+// so the client can merge or retry.
+func (h *Handler) versionConflict(w http.ResponseWriter, path string) {
+	current, err := h.Store.GetPad(path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to get pad")
+		return
+	}
+
+	w.Header().Set("ETag", padETag(current))
+	jsonResponse(w, http.StatusConflict, map[string]interface{}{
+		"error": "pad was modified since the given version",
+		"pad":   current,
+	})
+}
+
+// ApplyOps handles POST /api/pad/ops/*
+// Applies a collaborative editing operation made against a given pad version.
+// Operations based on an older version are transformed against the ones
+// applied since, and the result is fanned out to SSE clients as an "op" event.
+func (h *Handler) ApplyOps(w http.ResponseWriter, r *http.Request) {
+	path := extractPadPath(r, "/api/pad/ops/")
+	if r.URL.Path == "/api/pad/ops" || r.URL.Path == "/api/pad/ops/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorize(w, r, path, access.Write) {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.MaxContentSize+1))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to read request body")
+		return
+	}
+	if int64(len(body)) > h.MaxContentSize {
+		jsonError(w, http.StatusRequestEntityTooLarge, "operation exceeds maximum size")
+		return
+	}
+
+	var req struct {
+		Version int64        `json:"version"`
+		Ops     ot.Operation `json:"ops"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	pad, op, ok := h.applyPadOp(w, r, path, req.Ops, req.Version, true, "op")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", padETag(pad))
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"version": pad.Version,
+		"ops":     op,
+	})
+}
+
+// PatchPad handles PATCH /api/pad/content/*
+// Applies a diff (an operation, see package ot) against a base version given
+// in If-Match or the body's "version" field. Unlike ApplyOps the base must be
+// the current version; the diff is rejected with 409 otherwise.
+func (h *Handler) PatchPad(w http.ResponseWriter, r *http.Request) {
+	path := extractPadPath(r, "/api/pad/content/")
+	if r.URL.Path == "/api/pad/content" || r.URL.Path == "/api/pad/content/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorize(w, r, path, access.Write) {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.MaxContentSize+1))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to read request body")
+		return
+	}
+	if int64(len(body)) > h.MaxContentSize {
+		jsonError(w, http.StatusRequestEntityTooLarge, "patch exceeds maximum size")
+		return
+	}
+
+	var req struct {
+		Version *int64       `json:"version"`
+		Ops     ot.Operation `json:"ops"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	baseVersion, ok, err := ifMatchVersion(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !ok {
+		if req.Version == nil {
+			jsonError(w, http.StatusBadRequest, "base version is required (If-Match header or version field)")
+			return
+		}
+		baseVersion = *req.Version
+	}
+
+	pad, _, ok := h.applyPadOp(w, r, path, req.Ops, baseVersion, false, "update")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", padETag(pad))
+	jsonResponse(w, http.StatusOK, pad)
+}
+
+// applyPadOp applies op, made against baseVersion, to the pad at path and
+// notifies SSE clients with an event of the given type carrying the op.
+// With rebase set, an op based on an older version is transformed against
+// the operations applied since; otherwise the base must be current. On
+// failure the error response has been written and ok is false.
+func (h *Handler) applyPadOp(w http.ResponseWriter, r *http.Request, path string, op ot.Operation, baseVersion int64, rebase bool, eventType string) (pad *models.Pad, applied ot.Operation, ok bool) {
+	// Operations on a pad are ordered by holding its lock from reading the
+	// current version until the broadcast has been queued.
+	unlock := h.OpHistory.Lock(path)
+	defer unlock()
+
+	current, err := h.Store.GetPad(path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to get pad")
+		return nil, nil, false
+	}
+
+	if baseVersion != current.Version {
+		if !rebase {
+			h.versionConflict(w, path)
+			return nil, nil, false
+		}
+		op, err = h.OpHistory.Rebase(path, op, baseVersion, current.Version)
+		if errors.Is(err, ot.ErrStale) {
+			h.versionConflict(w, path)
+			return nil, nil, false
+		}
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "operation does not match pad content")
+			return nil, nil, false
+		}
+	}
+
+	content, err := ot.Apply(current.Content, op)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "operation does not match pad content")
+		return nil, nil, false
+	}
+	if int64(len(content)) > h.MaxContentSize {
+		jsonError(w, http.StatusRequestEntityTooLarge, "content exceeds maximum size")
+		return nil, nil, false
+	}
+
+	pad, err = h.Store.SavePadIfVersion(path, content, current.Version, author(r))
+	if errors.Is(err, storage.ErrVersionConflict) {
+		h.versionConflict(w, path)
+		return nil, nil, false
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save pad")
+		return nil, nil, false
+	}
+	h.OpHistory.Record(path, op, pad.Version)
+
+	h.Cache.Invalidate(path)
+	h.Cache.Set(path, pad)
+	h.Mirror.SyncPad(path)
+
+	clientID := r.URL.Query().Get("client_id")
+	h.Broadcaster.Broadcast(path, sse.Event{
+		Type:      eventType,
+		Ops:       op,
+		Version:   pad.Version,
+		UpdatedBy: pad.UpdatedBy,
+		ClientID:  clientID,
+	})
+
+	// A first save creates the pad, which changes its parent's children list.
+	if current.Version == 0 && path != "" {
+		parentPath := models.ParentPath(path)
+		h.Broadcaster.Broadcast(parentPath, sse.Event{
+			Type:     "children_changed",
+			Path:     parentPath,
+			ClientID: clientID,
+		})
+	}
+
+	return pad, op, true
+}
+
+// padSaved refreshes the cache and notifies SSE clients after a pad's
+// content has changed.
+func (h *Handler) padSaved(path string, pad *models.Pad, clientID string) {
 	// Invalidate cache and set fresh entry.
 	h.Cache.Invalidate(path)
 	h.Cache.Set(path, pad)
+	h.Mirror.SyncPad(path)
 
 	// Broadcast update event to SSE clients.
-	clientID := r.URL.Query().Get("client_id")
 	h.Broadcaster.Broadcast(path, sse.Event{
-		Type:     "update",
-		Content:  pad.Content,
-		ClientID: clientID,
+		Type:      "update",
+		Content:   pad.Content,
+		Version:   pad.Version,
+		UpdatedBy: pad.UpdatedBy,
+		ClientID:  clientID,
 	})
 
 	// Notify the parent path so tabs viewing it can refresh their children list.
@@ -127,8 +446,6 @@ func (h *Handler) SavePad(w http.ResponseWriter, r *http.Request) {
 			ClientID: clientID,
 		})
 	}
-
-	jsonResponse(w, http.StatusOK, pad)
 }
 
 // DeletePad handles DELETE /api/pad/content/*
@@ -142,8 +459,33 @@ func (h *Handler) DeletePad(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if !h.authorizeSubtree(w, r, path, access.Write) {
+		return
+	}
+	if !requireScope(w, r, models.ScopeDelete) {
+		return
+	}
 
-	count, err := h.Store.DeletePad(path)
+	// Guard against wiping out a large part of the tree by accident: the
+	// client has to echo back the number of pads it is about to delete. The
+	// threshold applies to descendants, which the count includes the pad
+	// itself on top of.
+	count, err := h.Store.CountSubtree(path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to delete pad")
+		return
+	}
+	if path == "" || count-1 > int64(h.DeleteConfirmThreshold) {
+		if r.URL.Query().Get("confirm") != strconv.FormatInt(count, 10) {
+			jsonResponse(w, http.StatusConflict, map[string]interface{}{
+				"error": "deletion must be confirmed with ?confirm=" + strconv.FormatInt(count, 10),
+				"count": count,
+			})
+			return
+		}
+	}
+
+	count, err = h.Store.DeletePad(path)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to delete pad")
 		return
@@ -155,6 +497,8 @@ func (h *Handler) DeletePad(w http.ResponseWriter, r *http.Request) {
 	} else {
 		h.Cache.InvalidatePrefix(path)
 	}
+	h.OpHistory.Forget(path)
+	h.Mirror.Sync(path)
 
 	// Broadcast delete event to SSE clients.
 	clientID := r.URL.Query().Get("client_id")
@@ -177,6 +521,377 @@ func (h *Handler) DeletePad(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, map[string]int64{"deleted": count})
 }
 
+// MovePad handles POST /api/pad/move/*
+// Moves a pad and its entire subtree to the "destination" path in the body.
+func (h *Handler) MovePad(w http.ResponseWriter, r *http.Request) {
+	mover, ok := h.Store.(storage.Mover)
+	if !ok {
+		notSupported(w, "moving pads")
+		return
+	}
+
+	path := extractPadPath(r, "/api/pad/move/")
+	if r.URL.Path == "/api/pad/move" || r.URL.Path == "/api/pad/move/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if path == "" {
+		jsonError(w, http.StatusBadRequest, "cannot move the root pad")
+		return
+	}
+
+	var req struct {
+		Destination string `json:"destination"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	dest := models.NormalizePath(req.Destination)
+	if err := models.ValidatePath(dest); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if dest == "" {
+		jsonError(w, http.StatusBadRequest, "destination is required")
+		return
+	}
+	if dest == path || strings.HasPrefix(dest, path+"/") {
+		jsonError(w, http.StatusBadRequest, "cannot move a pad into itself")
+		return
+	}
+	if !h.authorizeSubtree(w, r, path, access.Write) || !h.authorizeSubtree(w, r, dest, access.Write) {
+		return
+	}
+	// Moving removes the pads from their old place.
+	if !requireScope(w, r, models.ScopeDelete) {
+		return
+	}
+
+	count, err := mover.MovePad(path, dest)
+	switch {
+	case errors.Is(err, storage.ErrPadNotFound):
+		jsonError(w, http.StatusNotFound, "pad not found")
+		return
+	case errors.Is(err, storage.ErrDestinationExists):
+		jsonError(w, http.StatusConflict, "destination already exists")
+		return
+	case errors.Is(err, storage.ErrInvalidDestination):
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		jsonError(w, http.StatusInternalServerError, "failed to move pad")
+		return
+	}
+
+	h.Cache.InvalidatePrefix(path)
+	h.Cache.InvalidatePrefix(dest)
+	h.OpHistory.Forget(path)
+	h.Mirror.Sync(path)
+	h.Mirror.Sync(dest)
+
+	// Tabs viewing the moved pad follow it; tabs viewing either parent
+	// refresh their children list.
+	clientID := r.URL.Query().Get("client_id")
+	moved := sse.Event{
+		Type:        "moved",
+		Path:        path,
+		Destination: dest,
+		ClientID:    clientID,
+	}
+	h.Broadcaster.Broadcast(path, moved)
+	h.Broadcaster.Broadcast(models.ParentPath(path), moved)
+	if models.ParentPath(dest) != models.ParentPath(path) {
+		h.Broadcaster.Broadcast(models.ParentPath(dest), moved)
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"moved":       count,
+		"destination": dest,
+	})
+}
+
+// CopyPad handles POST /api/pad/copy/*
+// Deep-copies a pad and its subtree to the "destination" path in the body.
+// "on_conflict" is "fail" (default) or "overwrite".
+func (h *Handler) CopyPad(w http.ResponseWriter, r *http.Request) {
+	mover, ok := h.Store.(storage.Mover)
+	if !ok {
+		notSupported(w, "copying pads")
+		return
+	}
+
+	path := extractPadPath(r, "/api/pad/copy/")
+	if r.URL.Path == "/api/pad/copy" || r.URL.Path == "/api/pad/copy/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if path == "" {
+		jsonError(w, http.StatusBadRequest, "cannot copy the root pad")
+		return
+	}
+
+	var req struct {
+		Destination string `json:"destination"`
+		OnConflict  string `json:"on_conflict"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	dest := models.NormalizePath(req.Destination)
+	if err := models.ValidatePath(dest); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if dest == "" {
+		jsonError(w, http.StatusBadRequest, "destination is required")
+		return
+	}
+	if dest == path || strings.HasPrefix(dest, path+"/") {
+		jsonError(w, http.StatusBadRequest, "cannot copy a pad into itself")
+		return
+	}
+	if !h.authorizeSubtree(w, r, path, access.Read) || !h.authorizeSubtree(w, r, dest, access.Write) {
+		return
+	}
+
+	var overwrite bool
+	switch req.OnConflict {
+	case "", "fail":
+	case "overwrite":
+		overwrite = true
+	default:
+		jsonError(w, http.StatusBadRequest, `on_conflict must be "fail" or "overwrite"`)
+		return
+	}
+
+	pads, err := mover.CopyPad(path, dest, overwrite, author(r))
+	switch {
+	case errors.Is(err, storage.ErrPadNotFound):
+		jsonError(w, http.StatusNotFound, "pad not found")
+		return
+	case errors.Is(err, storage.ErrDestinationExists):
+		jsonError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, storage.ErrInvalidDestination):
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		jsonError(w, http.StatusInternalServerError, "failed to copy pad")
+		return
+	}
+
+	// Overwritten pads may be open elsewhere; refresh them and every parent
+	// whose children list changed.
+	clientID := r.URL.Query().Get("client_id")
+	h.Mirror.Sync(dest)
+	parents := map[string]bool{models.ParentPath(dest): true}
+	for _, pad := range pads {
+		h.Cache.Set(pad.Path, pad)
+		h.Broadcaster.Broadcast(pad.Path, sse.Event{
+			Type:      "update",
+			Content:   pad.Content,
+			Version:   pad.Version,
+			UpdatedBy: pad.UpdatedBy,
+			ClientID:  clientID,
+		})
+		parents[models.ParentPath(pad.Path)] = true
+	}
+	for parentPath := range parents {
+		h.Broadcaster.Broadcast(parentPath, sse.Event{
+			Type:     "children_changed",
+			Path:     parentPath,
+			ClientID: clientID,
+		})
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"copied":      len(pads),
+		"destination": dest,
+	})
+}
+
+// ExportPad handles GET /api/pad/export/*?format=zip|tar.gz
+// Streams the pad and its descendants as an archive of Markdown files.
+func (h *Handler) ExportPad(w http.ResponseWriter, r *http.Request) {
+	path := extractPadPath(r, "/api/pad/export/")
+	if r.URL.Path == "/api/pad/export" || r.URL.Path == "/api/pad/export/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorize(w, r, path, access.Read) {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = archive.FormatZip
+	}
+	if !archive.ValidFormat(format) {
+		jsonError(w, http.StatusBadRequest, `format must be "zip" or "tar.gz"`)
+		return
+	}
+
+	pads, err := h.Store.GetSubtree(path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to export pad")
+		return
+	}
+	if len(pads) == 0 && path != "" {
+		jsonError(w, http.StatusNotFound, "pad not found")
+		return
+	}
+	readable := pads[:0]
+	for _, pad := range pads {
+		if h.canRead(r, pad.Path) {
+			readable = append(readable, pad)
+		}
+	}
+	pads = readable
+
+	name := "pathpad"
+	if path != "" {
+		name += "-" + strings.ReplaceAll(path, "/", "-")
+	}
+	w.Header().Set("Content-Type", archive.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the archive short.
+	if err := archive.Write(w, format, path, pads); err != nil {
+		log.Printf("[http] Export of %q failed: %v", path, err)
+	}
+}
+
+// ImportPad handles POST /api/pad/import/*?on_conflict=skip|overwrite|rename&dry_run=true
+// Imports the Markdown and text files of a zip or tar.gz archive in the body
+// as descendants of the path.
+func (h *Handler) ImportPad(w http.ResponseWriter, r *http.Request) {
+	path := extractPadPath(r, "/api/pad/import/")
+	if r.URL.Path == "/api/pad/import" || r.URL.Path == "/api/pad/import/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorizeSubtree(w, r, path, access.Write) {
+		return
+	}
+
+	importer, ok := h.Store.(storage.Importer)
+	if !ok {
+		notSupported(w, "import")
+		return
+	}
+
+	query := r.URL.Query()
+	onConflict := query.Get("on_conflict")
+	switch onConflict {
+	case "":
+		onConflict = storage.ImportSkip
+	case storage.ImportSkip, storage.ImportOverwrite, storage.ImportRename:
+	default:
+		jsonError(w, http.StatusBadRequest, `on_conflict must be "skip", "overwrite" or "rename"`)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, h.MaxImportSize+1))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	if int64(len(data)) > h.MaxImportSize {
+		jsonError(w, http.StatusRequestEntityTooLarge, "archive exceeds maximum size")
+		return
+	}
+
+	files, err := archive.Read(data, h.MaxContentSize, h.MaxImportSize)
+	switch {
+	case errors.Is(err, archive.ErrTooLarge):
+		jsonError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case err != nil:
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Work out the pad path of every file, setting aside the ones that
+	// can't be imported.
+	pads, names, invalid := archive.Pads(files, path)
+
+	results, err := importer.ImportPads(path, pads, onConflict, dryRun, author(r))
+	switch {
+	case errors.Is(err, storage.ErrInvalidDestination):
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		jsonError(w, http.StatusInternalServerError, "failed to import pads")
+		return
+	}
+
+	var imported int
+	parents := map[string]bool{}
+	clientID := query.Get("client_id")
+	for i := range results {
+		results[i].File = names[i]
+		if results[i].Status == "skipped" {
+			continue
+		}
+		imported++
+		if dryRun {
+			continue
+		}
+
+		h.Mirror.SyncPad(results[i].Path)
+		pad, err := h.Store.GetPad(results[i].Path)
+		if err != nil {
+			h.Cache.Invalidate(results[i].Path)
+			continue
+		}
+		h.Cache.Set(pad.Path, pad)
+		h.Broadcaster.Broadcast(pad.Path, sse.Event{
+			Type:      "update",
+			Content:   pad.Content,
+			Version:   pad.Version,
+			UpdatedBy: pad.UpdatedBy,
+			ClientID:  clientID,
+		})
+		if pad.Path != "" {
+			parents[models.ParentPath(pad.Path)] = true
+		}
+	}
+	for parentPath := range parents {
+		h.Broadcaster.Broadcast(parentPath, sse.Event{
+			Type:     "children_changed",
+			Path:     parentPath,
+			ClientID: clientID,
+		})
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"dry_run":  dryRun,
+		"imported": imported,
+		"pads":     results,
+		"invalid":  invalid,
+	})
+}
+
 // GetChildren handles GET /api/pad/children/*
 func (h *Handler) GetChildren(w http.ResponseWriter, r *http.Request) {
 	path := extractPadPath(r, "/api/pad/children/")
@@ -188,16 +903,274 @@ func (h *Handler) GetChildren(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if !h.authorize(w, r, path, access.Read) {
+		return
+	}
 
 	children, err := h.Store.GetChildren(path)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to get children")
 		return
 	}
+	readable := children[:0]
+	for _, child := range children {
+		if h.canRead(r, child.Path) {
+			readable = append(readable, child)
+		}
+	}
+	children = readable
 
 	jsonResponse(w, http.StatusOK, map[string]interface{}{"children": children})
 }
 
+// Search handles GET /api/pad/search?q=...&prefix=...&limit=...
+// Returns pads whose path or content match q, best matches first.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	searcher, ok := h.Store.(storage.Searcher)
+	if !ok {
+		notSupported(w, "search")
+		return
+	}
+
+	query := r.URL.Query()
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		jsonError(w, http.StatusBadRequest, "q query parameter is required")
+		return
+	}
+
+	prefix := models.NormalizePath(query.Get("prefix"))
+	if err := models.ValidatePath(prefix); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := 20
+	if limitParam := query.Get("limit"); limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n < 1 {
+			jsonError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, 100)
+	}
+
+	results, err := searcher.SearchPads(q, prefix, limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to search pads")
+		return
+	}
+	readable := results[:0]
+	for _, result := range results {
+		if h.canRead(r, result.Path) {
+			readable = append(readable, result)
+		}
+	}
+	results = readable
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+// GetHistory handles GET /api/pad/history/*
+// Lists the pad's revisions, or returns a single revision with ?rev=N.
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.Store.(storage.RevisionStore)
+	if !ok {
+		notSupported(w, "revision history")
+		return
+	}
+
+	path := extractPadPath(r, "/api/pad/history/")
+	if r.URL.Path == "/api/pad/history" || r.URL.Path == "/api/pad/history/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorize(w, r, path, access.Read) {
+		return
+	}
+
+	if revParam := r.URL.Query().Get("rev"); revParam != "" {
+		rev, err := strconv.ParseInt(revParam, 10, 64)
+		if err != nil || rev < 1 {
+			jsonError(w, http.StatusBadRequest, "rev must be a positive integer")
+			return
+		}
+
+		revision, err := history.GetRevision(path, rev)
+		if errors.Is(err, storage.ErrRevisionNotFound) {
+			jsonError(w, http.StatusNotFound, "revision not found")
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to get revision")
+			return
+		}
+
+		jsonResponse(w, http.StatusOK, revision)
+		return
+	}
+
+	revisions, err := history.ListRevisions(path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list revisions")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"revisions": revisions})
+}
+
+// RestorePad handles POST /api/pad/restore/*
+// Makes a previous revision the pad's current content.
+func (h *Handler) RestorePad(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.Store.(storage.RevisionStore)
+	if !ok {
+		notSupported(w, "revision history")
+		return
+	}
+
+	path := extractPadPath(r, "/api/pad/restore/")
+	if r.URL.Path == "/api/pad/restore" || r.URL.Path == "/api/pad/restore/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorize(w, r, path, access.Write) {
+		return
+	}
+
+	var req struct {
+		Rev int64 `json:"rev"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Rev < 1 {
+		jsonError(w, http.StatusBadRequest, "rev must be a positive integer")
+		return
+	}
+
+	pad, err := history.RestoreRevision(path, req.Rev, author(r))
+	if errors.Is(err, storage.ErrRevisionNotFound) {
+		jsonError(w, http.StatusNotFound, "revision not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to restore revision")
+		return
+	}
+
+	h.padSaved(path, pad, r.URL.Query().Get("client_id"))
+
+	jsonResponse(w, http.StatusOK, pad)
+}
+
+// ListTrash handles GET /api/pad/trash
+// Lists deleted pads, most recently deleted first.
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	trash, ok := h.Store.(storage.TrashStore)
+	if !ok {
+		notSupported(w, "trash")
+		return
+	}
+
+	trashed, err := trash.ListTrash()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list trash")
+		return
+	}
+	readable := trashed[:0]
+	for _, pad := range trashed {
+		if h.canRead(r, pad.Path) {
+			readable = append(readable, pad)
+		}
+	}
+	trashed = readable
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"trash": trashed})
+}
+
+// RestoreTrash handles POST /api/pad/trash/restore/*
+// Restores a deleted pad together with the descendants deleted along with it.
+// Restores the most recent deletion of the path unless ?id= names a trash entry.
+func (h *Handler) RestoreTrash(w http.ResponseWriter, r *http.Request) {
+	trash, ok := h.Store.(storage.TrashStore)
+	if !ok {
+		notSupported(w, "trash")
+		return
+	}
+
+	path := extractPadPath(r, "/api/pad/trash/restore/")
+	if r.URL.Path == "/api/pad/trash/restore" || r.URL.Path == "/api/pad/trash/restore/" {
+		path = ""
+	}
+
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorizeSubtree(w, r, path, access.Write) {
+		return
+	}
+
+	var id int64
+	if idParam := r.URL.Query().Get("id"); idParam != "" {
+		n, err := strconv.ParseInt(idParam, 10, 64)
+		if err != nil || n < 1 {
+			jsonError(w, http.StatusBadRequest, "id must be a positive integer")
+			return
+		}
+		id = n
+	}
+
+	pads, err := trash.RestoreTrash(path, id)
+	switch {
+	case errors.Is(err, storage.ErrNotInTrash):
+		jsonError(w, http.StatusNotFound, "pad not found in trash")
+		return
+	case errors.Is(err, storage.ErrDestinationExists):
+		jsonError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		jsonError(w, http.StatusInternalServerError, "failed to restore pad")
+		return
+	}
+
+	clientID := r.URL.Query().Get("client_id")
+	parents := map[string]bool{}
+	for _, pad := range pads {
+		h.Cache.Set(pad.Path, pad)
+		h.Mirror.SyncPad(pad.Path)
+		h.Broadcaster.Broadcast(pad.Path, sse.Event{
+			Type:      "update",
+			Content:   pad.Content,
+			Version:   pad.Version,
+			UpdatedBy: pad.UpdatedBy,
+			ClientID:  clientID,
+		})
+		if pad.Path != "" {
+			parents[models.ParentPath(pad.Path)] = true
+		}
+	}
+	for parentPath := range parents {
+		h.Broadcaster.Broadcast(parentPath, sse.Event{
+			Type:     "children_changed",
+			Path:     parentPath,
+			ClientID: clientID,
+		})
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"restored": len(pads)})
+}
+
 // Events handles GET /api/pad/events/*
 func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
 	path := extractPadPath(r, "/api/pad/events/")
@@ -205,6 +1178,14 @@ func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
 		path = ""
 	}
 
+	if err := models.ValidatePath(path); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.authorize(w, r, path, access.Read) {
+		return
+	}
+
 	clientID := r.URL.Query().Get("client_id")
 	if clientID == "" {
 		jsonError(w, http.StatusBadRequest, "client_id query parameter is required")
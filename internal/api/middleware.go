@@ -1,11 +1,16 @@
 package api
 
 import (
+	"crypto/subtle"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"pathpad/internal/access"
+	"pathpad/internal/models"
 )
 
 // RequestLogger logs method, path, status, and duration for each request.
@@ -54,8 +59,9 @@ func CORS(allowedOrigins string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", allowedOrigins)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Authorization")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Pathpad-Access")
 
 			if r.Method == http.MethodOptions {
 				w.WriteHeader(http.StatusOK)
@@ -67,7 +73,38 @@ func CORS(allowedOrigins string) func(http.Handler) http.Handler {
 	}
 }
 
-// RateLimiter provides per-IP rate limiting.
+// RequireAdmin only lets through requests carrying the admin token as a
+// bearer token, or an API key with the admin scope. With no token
+// configured the admin API is disabled.
+func RequireAdmin(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				jsonError(w, http.StatusForbidden, "admin API is disabled; set PATHPAD_ADMIN_TOKEN to enable it")
+				return
+			}
+			if key := access.APIKeyFromContext(r.Context()); key != nil {
+				if !key.HasScope(models.ScopeAdmin) {
+					jsonError(w, http.StatusForbidden, "API key lacks the admin scope")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="pathpad-admin"`)
+				jsonError(w, http.StatusUnauthorized, "admin token required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimiter provides per-IP rate limiting. Requests with an API key are
+// counted per key instead, against the key's own limit if it has one. Every
+// request is counted per IP first, so that guessing keys is limited too.
 type RateLimiter struct {
 	mu       sync.Mutex
 	visitors map[string]*visitor
@@ -104,33 +141,74 @@ func NewRateLimiter(requestsPerMinute int) *RateLimiter {
 	return rl
 }
 
-// Middleware returns the rate limiting middleware handler.
+// Middleware returns the per-IP rate limiting middleware handler. It runs
+// before API keys are looked up.
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := extractIP(r)
+		if !rl.allow(extractIP(r), rl.limit) {
+			rateLimitExceeded(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		rl.mu.Lock()
-		v, exists := rl.visitors[ip]
-		now := time.Now()
-		if !exists || now.After(v.resetAt) {
-			rl.visitors[ip] = &visitor{count: 1, resetAt: now.Add(rl.window)}
-			rl.mu.Unlock()
+// KeyMiddleware moves requests with a valid API key from their IP's count
+// to the key's. It runs after API keys are looked up, so requests with an
+// unknown key stay counted against their IP.
+func (rl *RateLimiter) KeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := access.APIKeyFromContext(r.Context())
+		if key == nil {
 			next.ServeHTTP(w, r)
 			return
 		}
-		v.count++
-		if v.count > rl.limit {
-			rl.mu.Unlock()
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusTooManyRequests)
-			w.Write([]byte(`{"error":"rate limit exceeded"}`))
+
+		rl.refund(extractIP(r))
+		limit := rl.limit
+		if key.RateLimit > 0 {
+			limit = key.RateLimit
+		}
+		if !rl.allow("key:"+strconv.FormatInt(key.ID, 10), limit) {
+			rateLimitExceeded(w)
 			return
 		}
-		rl.mu.Unlock()
 		next.ServeHTTP(w, r)
 	})
 }
 
+// allow counts a request against id and reports whether id is still within
+// limit requests in the current window.
+func (rl *RateLimiter) allow(id string, limit int) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	v, exists := rl.visitors[id]
+	now := time.Now()
+	if !exists || now.After(v.resetAt) {
+		rl.visitors[id] = &visitor{count: 1, resetAt: now.Add(rl.window)}
+		return true
+	}
+	v.count++
+	return v.count <= limit
+}
+
+// refund takes back a request counted against id.
+func (rl *RateLimiter) refund(id string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if v, exists := rl.visitors[id]; exists && v.count > 0 {
+		v.count--
+	}
+}
+
+func rateLimitExceeded(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(`{"error":"rate limit exceeded"}`))
+}
+
 // extractIP gets the client IP from X-Forwarded-For or RemoteAddr.
 func extractIP(r *http.Request) string {
 	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
@@ -7,27 +7,45 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"pathpad/internal/access"
 	"pathpad/internal/config"
+	"pathpad/internal/ot"
 	"pathpad/internal/sse"
 	"pathpad/internal/storage"
 )
 
 // NewRouter creates and configures the Chi router with all routes and middleware.
-func NewRouter(cfg *config.Config, store *storage.SQLiteStore, cache *storage.Cache, broadcaster *sse.Broadcaster, staticFS fs.FS) http.Handler {
+// mirror may be nil. sso puts single sign-on in front of the routes; nil if
+// it isn't configured.
+func NewRouter(cfg *config.Config, store storage.Store, cache *storage.Cache, broadcaster *sse.Broadcaster, accessControl *access.Controller, mirror *storage.Mirror, sso func(http.Handler) http.Handler, staticFS fs.FS) http.Handler {
 	r := chi.NewRouter()
 
 	// Global middleware stack.
 	r.Use(Recovery)
 	r.Use(RequestLogger)
 	r.Use(CORS(cfg.CORSOrigins))
-	r.Use(NewRateLimiter(cfg.RateLimit).Middleware)
+	rateLimiter := NewRateLimiter(cfg.RateLimit)
+	r.Use(rateLimiter.Middleware)
+	r.Use(accessControl.APIKeyMiddleware)
+	r.Use(rateLimiter.KeyMiddleware)
+	// Sign-in checks credentials too, so it goes after rate limiting, where
+	// requests guessing them are counted.
+	if sso != nil {
+		r.Use(sso)
+	}
 
 	// Create handler with dependencies.
 	h := &Handler{
-		Store:          store,
-		Cache:          cache,
-		Broadcaster:    broadcaster,
-		MaxContentSize: cfg.MaxContentSize,
+		Store:                  store,
+		Cache:                  cache,
+		Broadcaster:            broadcaster,
+		Access:                 accessControl,
+		OpHistory:              ot.NewHistory(200),
+		MaxContentSize:         cfg.MaxContentSize,
+		MaxImportSize:          cfg.MaxImportSize,
+		UnlockTTL:              cfg.UnlockTTL,
+		DeleteConfirmThreshold: cfg.DeleteConfirmThreshold,
+		Mirror:                 mirror,
 	}
 
 	// Health check.
@@ -35,23 +53,88 @@ func NewRouter(cfg *config.Config, store *storage.SQLiteStore, cache *storage.Ca
 
 	// API routes — Vault-style prefix: /api/pad/{operation}/*
 	r.Route("/api/pad", func(r chi.Router) {
+		// Access rules, tokens and share links.
+		r.Use(accessControl.Middleware)
+
 		// Content CRUD.
 		r.Get("/content", h.GetPad)
 		r.Get("/content/*", h.GetPad)
 		r.Put("/content", h.SavePad)
 		r.Put("/content/*", h.SavePad)
+		r.Patch("/content", h.PatchPad)
+		r.Patch("/content/*", h.PatchPad)
 		r.Delete("/content", h.DeletePad)
 		r.Delete("/content/*", h.DeletePad)
 
+		// Collaborative editing operations.
+		r.Post("/ops", h.ApplyOps)
+		r.Post("/ops/*", h.ApplyOps)
+
+		// Subtree reorganization.
+		r.Post("/move", h.MovePad)
+		r.Post("/move/*", h.MovePad)
+		r.Post("/copy", h.CopyPad)
+		r.Post("/copy/*", h.CopyPad)
+
+		// Bulk export and import.
+		r.Get("/export", h.ExportPad)
+		r.Get("/export/*", h.ExportPad)
+		r.Post("/import", h.ImportPad)
+		r.Post("/import/*", h.ImportPad)
+
 		// Children listing.
 		r.Get("/children", h.GetChildren)
 		r.Get("/children/*", h.GetChildren)
 
+		// Full-text search.
+		r.Get("/search", h.Search)
+
+		// Revision history.
+		r.Get("/history", h.GetHistory)
+		r.Get("/history/*", h.GetHistory)
+		r.Post("/restore", h.RestorePad)
+		r.Post("/restore/*", h.RestorePad)
+
+		// Trash bin.
+		r.Get("/trash", h.ListTrash)
+		r.Post("/trash/restore", h.RestoreTrash)
+		r.Post("/trash/restore/*", h.RestoreTrash)
+
+		// Password-protected pads.
+		r.Post("/unlock", h.UnlockPad)
+		r.Post("/unlock/*", h.UnlockPad)
+
 		// SSE events.
 		r.Get("/events", h.Events)
 		r.Get("/events/*", h.Events)
 	})
 
+	// Admin routes, only reachable with PATHPAD_ADMIN_TOKEN.
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(RequireAdmin(cfg.AdminToken))
+		r.Get("/backup", h.Backup)
+
+		// Access control.
+		r.Get("/rules", h.ListAccessRules)
+		r.Put("/rules", h.SetAccessRule)
+		r.Put("/rules/*", h.SetAccessRule)
+		r.Delete("/rules", h.DeleteAccessRule)
+		r.Delete("/rules/*", h.DeleteAccessRule)
+		r.Get("/tokens", h.ListAccessTokens)
+		r.Post("/tokens", h.CreateAccessToken)
+		r.Delete("/tokens/{id}", h.DeleteAccessToken)
+		r.Get("/keys", h.ListAPIKeys)
+		r.Post("/keys", h.CreateAPIKey)
+		r.Delete("/keys/{id}", h.DeleteAPIKey)
+		r.Post("/share-links", h.CreateShareLink)
+		r.Delete("/share-links", h.RevokeShareLinks)
+		r.Get("/locks", h.ListPadLocks)
+		r.Put("/locks", h.SetPadLock)
+		r.Put("/locks/*", h.SetPadLock)
+		r.Delete("/locks", h.DeletePadLock)
+		r.Delete("/locks/*", h.DeletePadLock)
+	})
+
 	// Strip the "static" prefix from the embedded FS so files are at root.
 	subFS, err := fs.Sub(staticFS, "static")
 	if err != nil {
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log"
+
+	"pathpad/internal/models"
+	"pathpad/internal/sse"
+	"pathpad/internal/storage"
+)
+
+// WatchStore keeps the cache and SSE clients in sync with pads changed
+// outside of Pathpad, such as Markdown files edited on disk. Call the
+// returned function to stop watching.
+func WatchStore(store storage.Store, cache *storage.Cache, broadcaster *sse.Broadcaster) (stop func() error, err error) {
+	watcher, ok := store.(storage.Watcher)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+
+	h := &Handler{Store: store, Cache: cache, Broadcaster: broadcaster}
+	return watcher.Watch(h.padsChangedExternally)
+}
+
+// WatchMirror is WatchStore for a mirror directory: pads changed there are
+// copied into store, then the cache and SSE clients are updated.
+func WatchMirror(mirror *storage.Mirror, store storage.Store, cache *storage.Cache, broadcaster *sse.Broadcaster) (stop func() error, err error) {
+	h := &Handler{Store: store, Cache: cache, Broadcaster: broadcaster}
+	return mirror.Watch(h.padsChangedExternally)
+}
+
+// padsChangedExternally sends the same events as a save or delete through
+// the API would, without a client ID so that every tab picks them up.
+func (h *Handler) padsChangedExternally(paths []string) {
+	for _, path := range paths {
+		pad, err := h.Store.GetPad(path)
+		if err != nil {
+			log.Printf("[sse] Failed to read externally changed pad %q: %v", path, err)
+			h.Cache.Invalidate(path)
+			continue
+		}
+
+		if pad.Version > 0 {
+			h.padSaved(path, pad, "")
+			continue
+		}
+
+		h.Cache.Invalidate(path)
+		h.Broadcaster.Broadcast(path, sse.Event{
+			Type: "delete",
+			Path: path,
+		})
+		if path != "" {
+			parentPath := models.ParentPath(path)
+			h.Broadcaster.Broadcast(parentPath, sse.Event{
+				Type: "children_changed",
+				Path: parentPath,
+			})
+		}
+	}
+}
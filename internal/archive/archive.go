@@ -0,0 +1,180 @@
+// Package archive converts pad subtrees to and from zip and tar.gz archives
+// of Markdown files. The directory layout follows the pad hierarchy, relative
+// to the exported pad: the pad itself is index.md, a descendant a/b is a/b.md,
+// or a/b/index.md when it has descendants of its own. A manifest.json next
+// to the files records each pad's path and timestamps.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// Supported archive formats.
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+// ManifestName is the name of the manifest file in an archive.
+const ManifestName = "manifest.json"
+
+const indexFile = "index.md"
+
+// Manifest describes the pads in an archive.
+type Manifest struct {
+	Prefix     string          `json:"prefix"`
+	ExportedAt int64           `json:"exported_at"`
+	Files      []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes a single pad file.
+type ManifestEntry struct {
+	File      string `json:"file"`
+	Path      string `json:"path"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// ValidFormat reports whether format is a supported archive format.
+func ValidFormat(format string) bool {
+	return format == FormatZip || format == FormatTarGz
+}
+
+// ContentType returns the MIME type of an archive format.
+func ContentType(format string) string {
+	if format == FormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// Write writes pads, all in the subtree rooted at prefix, to w as an archive
+// in the given format.
+func Write(w io.Writer, format, prefix string, pads []*models.Pad) error {
+	manifest := Manifest{
+		Prefix:     prefix,
+		ExportedAt: time.Now().Unix(),
+		Files:      make([]ManifestEntry, 0, len(pads)),
+	}
+
+	// Pads with descendants are stored as index.md in their own directory.
+	hasDescendants := map[string]bool{}
+	for _, pad := range pads {
+		for p := models.ParentPath(pad.Path); p != prefix && p != ""; p = models.ParentPath(p) {
+			hasDescendants[p] = true
+		}
+	}
+	for _, pad := range pads {
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			File:      fileName(relPath(pad.Path, prefix), hasDescendants[pad.Path]),
+			Path:      pad.Path,
+			CreatedAt: pad.CreatedAt,
+			UpdatedAt: pad.UpdatedAt,
+		})
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatZip:
+		return writeZip(w, manifest, manifestJSON, pads)
+	case FormatTarGz:
+		return writeTarGz(w, manifest, manifestJSON, pads)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+func writeZip(w io.Writer, manifest Manifest, manifestJSON []byte, pads []*models.Pad) error {
+	zw := zip.NewWriter(w)
+
+	write := func(name string, modTime int64, data []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: time.Unix(modTime, 0),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+
+	if err := write(ManifestName, manifest.ExportedAt, manifestJSON); err != nil {
+		return err
+	}
+	for i, pad := range pads {
+		if err := write(manifest.Files[i].File, pad.UpdatedAt, []byte(pad.Content)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, manifest Manifest, manifestJSON []byte, pads []*models.Pad) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	write := func(name string, modTime int64, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  time.Unix(modTime, 0),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	if err := write(ManifestName, manifest.ExportedAt, manifestJSON); err != nil {
+		return err
+	}
+	for i, pad := range pads {
+		if err := write(manifest.Files[i].File, pad.UpdatedAt, []byte(pad.Content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// relPath returns path relative to prefix, which must be path or one of its
+// ancestors.
+func relPath(path, prefix string) string {
+	if prefix == "" || path == prefix {
+		return strings.TrimPrefix(path, prefix)
+	}
+	return strings.TrimPrefix(path, prefix+"/")
+}
+
+// fileName returns the archive file holding the pad at rel. A pad named
+// index always gets its own directory so it can't be mistaken for its
+// parent's index.md.
+func fileName(rel string, hasDescendants bool) string {
+	if rel == "" {
+		return indexFile
+	}
+	if hasDescendants || rel == "index" || strings.HasSuffix(rel, "/index") {
+		return rel + "/" + indexFile
+	}
+	return rel + ".md"
+}
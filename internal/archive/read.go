@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"pathpad/internal/models"
+)
+
+var (
+	// ErrUnknownFormat is returned for data that is neither zip nor tar.gz.
+	ErrUnknownFormat = errors.New("archive is not a zip or tar.gz file")
+
+	// ErrTooLarge is returned when the unpacked files exceed the size limit.
+	ErrTooLarge = errors.New("archive contents exceed the size limit")
+)
+
+// InvalidFile is an archive file that can't be imported as a pad.
+type InvalidFile struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// File is a regular file read from an archive. Oversized is set instead of
+// Content for files larger than the per-file limit.
+type File struct {
+	Name      string
+	Content   []byte
+	Oversized bool
+}
+
+// Read unpacks the regular files of a zip or tar.gz archive. Files larger
+// than maxFileSize are returned without content, and ErrTooLarge is returned
+// if the files add up to more than maxTotalSize.
+func Read(data []byte, maxFileSize, maxTotalSize int64) ([]File, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return readZip(data, maxFileSize, maxTotalSize)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return readTarGz(data, maxFileSize, maxTotalSize)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func readZip(data []byte, maxFileSize, maxTotalSize int64) ([]File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("read zip: %w", err)
+	}
+
+	var files []File
+	var total int64
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		file, err := readFile(f.Name, rc, maxFileSize, &total, maxTotalSize)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func readTarGz(data []byte, maxFileSize, maxTotalSize int64) ([]File, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("read gzip: %w", err)
+	}
+	defer gr.Close()
+
+	var files []File
+	var total int64
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		file, err := readFile(hdr.Name, tr, maxFileSize, &total, maxTotalSize)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+}
+
+// readFile reads a file of at most maxFileSize bytes, adding its size to
+// total.
+func readFile(name string, r io.Reader, maxFileSize int64, total *int64, maxTotalSize int64) (File, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return File{}, fmt.Errorf("read %s: %w", name, err)
+	}
+	*total += int64(len(content))
+	if *total > maxTotalSize {
+		return File{}, ErrTooLarge
+	}
+	if int64(len(content)) > maxFileSize {
+		return File{Name: name, Oversized: true}, nil
+	}
+	return File{Name: name, Content: content}, nil
+}
+
+// PadPath maps an archive file name to a pad path relative to the import
+// target, reversing the export layout: a/b.md and a/b/index.md both become
+// a/b, and index.md becomes the target itself. Plain .txt files are mapped
+// the same way. ok is false for files that aren't pads at all, such as the
+// manifest, other file types, and hidden files. The result still needs to be
+// validated.
+func PadPath(name string) (rel string, ok bool) {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+	if name == ManifestName {
+		return "", false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		// Hidden files, and the resource forks macOS adds to zip files.
+		if strings.HasPrefix(segment, ".") || segment == "__MACOSX" {
+			return "", false
+		}
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+	if ext != ".md" && ext != ".txt" {
+		return "", false
+	}
+	rel = strings.TrimSuffix(name, path.Ext(name))
+	if strings.EqualFold(path.Base(rel), "index") {
+		rel = path.Dir(rel)
+		if rel == "." {
+			rel = ""
+		}
+	}
+	return models.NormalizePath(rel), true
+}
+
+// Pads maps archive files to pads under prefix, using PadPath. It returns
+// the pads along with the name of the file each came from, and the files
+// that would be pads but can't be imported: those with an invalid path, with
+// too much content, or mapping to the same path as an earlier file.
+func Pads(files []File, prefix string) (pads []*models.Pad, names []string, invalid []InvalidFile) {
+	invalid = []InvalidFile{}
+	seen := map[string]string{}
+	for _, file := range files {
+		rel, ok := PadPath(file.Name)
+		if !ok {
+			continue
+		}
+		padPath := rel
+		if prefix != "" {
+			padPath = strings.TrimSuffix(prefix+"/"+rel, "/")
+		}
+
+		var reason string
+		if err := models.ValidatePath(padPath); err != nil {
+			reason = err.Error()
+		} else if file.Oversized {
+			reason = "content exceeds maximum size"
+		} else if other, dup := seen[padPath]; dup {
+			reason = "same pad path as " + other
+		}
+		if reason != "" {
+			invalid = append(invalid, InvalidFile{File: file.Name, Error: reason})
+			continue
+		}
+
+		seen[padPath] = file.Name
+		pads = append(pads, &models.Pad{Path: padPath, Content: string(file.Content)})
+		names = append(names, file.Name)
+	}
+	return pads, names, invalid
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+
+	"pathpad/internal/config"
+)
+
+// Cookie names.
+const (
+	sessionCookie = "pathpad_session"
+	loginCookie   = "pathpad_login" // state of a sign-in in progress
+)
+
+// loginTimeout is how long a user has to complete a sign-in at the provider.
+const loginTimeout = 10 * time.Minute
+
+// OIDC signs users in with the OpenID Connect authorization code flow.
+type OIDC struct {
+	oauth         oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	signer        cookieSigner
+	ttl           time.Duration
+	secure        bool                     // set cookies only over HTTPS
+	authenticated func(*http.Request) bool // whether a request carries a valid credential
+}
+
+// loginState is kept in a cookie between sending the user to the provider
+// and the callback.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+}
+
+// NewOIDC discovers the provider at cfg.OIDCIssuer. Use oidc.ClientContext
+// on ctx to talk to the provider with a custom HTTP client. Requests for
+// which authenticated returns true, such as those carrying a valid access
+// token, don't need a session.
+func NewOIDC(ctx context.Context, cfg *config.Config, authenticated func(*http.Request) bool) (*OIDC, error) {
+	switch {
+	case cfg.OIDCIssuer == "":
+		return nil, errors.New("PATHPAD_OIDC_ISSUER is required")
+	case cfg.OIDCClientID == "":
+		return nil, errors.New("PATHPAD_OIDC_CLIENT_ID is required")
+	case cfg.OIDCRedirectURL == "":
+		return nil, errors.New("PATHPAD_OIDC_REDIRECT_URL is required")
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover provider %q: %w", cfg.OIDCIssuer, err)
+	}
+
+	key := []byte(cfg.SessionSecret)
+	if len(key) == 0 {
+		log.Printf("[startup] PATHPAD_SESSION_SECRET is not set; users have to sign in again after a restart")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &OIDC{
+		oauth: oauth2.Config{
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+		},
+		verifier:      provider.Verifier(&oidc.Config{ClientID: cfg.OIDCClientID}),
+		signer:        cookieSigner{key: key},
+		ttl:           cfg.SessionTTL,
+		secure:        strings.HasPrefix(cfg.OIDCRedirectURL, "https://"),
+		authenticated: authenticated,
+	}, nil
+}
+
+// Handler puts sign-in in front of next. It serves the /auth/ routes and
+// passes other requests on with the signed-in user in their context.
+// Requests without a session are sent to sign in, or get a 401 for the API.
+// Requests carrying a valid access token, as well as the admin API and
+// health check, are left to next to authorize.
+func (o *OIDC) Handler(next http.Handler) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/auth/login", o.login)
+	r.Get("/auth/callback", o.callback)
+	r.Post("/auth/logout", o.logout)
+	r.Get("/auth/me", o.me)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/auth/") {
+			r.ServeHTTP(w, req)
+			return
+		}
+		if id := o.session(req); id != nil {
+			next.ServeHTTP(w, req.WithContext(WithIdentity(req.Context(), id)))
+			return
+		}
+		if o.exempt(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if req.Method != http.MethodGet || strings.HasPrefix(req.URL.Path, "/api/") {
+			jsonError(w, http.StatusUnauthorized, "sign-in required")
+			return
+		}
+		http.Redirect(w, req, "/auth/login?next="+url.QueryEscape(req.URL.RequestURI()), http.StatusFound)
+	})
+}
+
+// exempt reports whether a request may go on without a session. Merely
+// carrying a credential isn't enough; it has to be valid.
+func (o *OIDC) exempt(r *http.Request) bool {
+	return r.URL.Path == "/healthz" ||
+		strings.HasPrefix(r.URL.Path, "/api/admin/") ||
+		(o.authenticated != nil && o.authenticated(r))
+}
+
+// session returns the user of the request's session cookie, or nil.
+func (o *OIDC) session(r *http.Request) *Identity {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	var id Identity
+	if err := o.signer.decode(sessionCookie, cookie.Value, &id); err != nil {
+		return nil
+	}
+	return &id
+}
+
+// login handles GET /auth/login?next=...
+// Sends the user to the provider to sign in.
+func (o *OIDC) login(w http.ResponseWriter, r *http.Request) {
+	state := loginState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: oauth2.GenerateVerifier(),
+		Next:     localPath(r.URL.Query().Get("next")),
+	}
+	expires := time.Now().Add(loginTimeout)
+	value, err := o.signer.encode(loginCookie, state, expires)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to start sign-in")
+		return
+	}
+	http.SetCookie(w, o.cookie(loginCookie, value, expires))
+
+	http.Redirect(w, r, o.oauth.AuthCodeURL(state.State,
+		oidc.Nonce(state.Nonce),
+		oauth2.S256ChallengeOption(state.Verifier),
+	), http.StatusFound)
+}
+
+// callback handles GET /auth/callback, where the provider sends the user
+// back after signing in.
+func (o *OIDC) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		log.Printf("[auth] Sign-in failed at the provider: %s %s", errCode, query.Get("error_description"))
+		jsonError(w, http.StatusUnauthorized, "sign-in failed: "+errCode)
+		return
+	}
+
+	var state loginState
+	cookie, err := r.Cookie(loginCookie)
+	if err == nil {
+		err = o.signer.decode(loginCookie, cookie.Value, &state)
+	}
+	if err != nil || query.Get("state") != state.State {
+		jsonError(w, http.StatusBadRequest, "sign-in expired or was started elsewhere; try again")
+		return
+	}
+	http.SetCookie(w, o.clearCookie(loginCookie))
+
+	token, err := o.oauth.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		log.Printf("[auth] Code exchange failed: %v", err)
+		jsonError(w, http.StatusUnauthorized, "sign-in failed")
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		log.Printf("[auth] Token response has no ID token")
+		jsonError(w, http.StatusUnauthorized, "sign-in failed")
+		return
+	}
+	idToken, err := o.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		log.Printf("[auth] Invalid ID token: %v", err)
+		jsonError(w, http.StatusUnauthorized, "sign-in failed")
+		return
+	}
+	if idToken.Nonce != state.Nonce {
+		log.Printf("[auth] ID token nonce mismatch")
+		jsonError(w, http.StatusUnauthorized, "sign-in failed")
+		return
+	}
+
+	var claims struct {
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+		Email             string `json:"email"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		log.Printf("[auth] Invalid ID token claims: %v", err)
+		jsonError(w, http.StatusUnauthorized, "sign-in failed")
+		return
+	}
+	id := &Identity{Subject: idToken.Subject, Name: claims.Name, Email: claims.Email}
+	for _, name := range []string{claims.Name, claims.PreferredUsername, claims.Email, idToken.Subject} {
+		if name != "" {
+			id.Name = name
+			break
+		}
+	}
+
+	expires := time.Now().Add(o.ttl)
+	value, err := o.signer.encode(sessionCookie, id, expires)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to start session")
+		return
+	}
+	http.SetCookie(w, o.cookie(sessionCookie, value, expires))
+
+	log.Printf("[auth] %s signed in", id.Name)
+	http.Redirect(w, r, state.Next, http.StatusFound)
+}
+
+// logout handles POST /auth/logout
+// Ends the session. It doesn't sign the user out at the provider.
+func (o *OIDC) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, o.clearCookie(sessionCookie))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// me handles GET /auth/me
+// Returns the signed-in user.
+func (o *OIDC) me(w http.ResponseWriter, r *http.Request) {
+	id := o.session(r)
+	if id == nil {
+		jsonError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	jsonResponse(w, http.StatusOK, id)
+}
+
+func (o *OIDC) cookie(name, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   o.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (o *OIDC) clearCookie(name string) *http.Cookie {
+	cookie := o.cookie(name, "", time.Time{})
+	cookie.MaxAge = -1
+	return cookie
+}
+
+// localPath returns next if it is a path on this server, so sign-in can't
+// be used to redirect elsewhere, and "/" otherwise.
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
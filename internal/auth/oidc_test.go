@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pathpad/internal/config"
+)
+
+const testClientID = "pathpad"
+
+// mockProvider is a minimal OpenID Connect provider: discovery, JWKS and a
+// token endpoint that issues an ID token for whatever nonce it is told.
+type mockProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	nonce string // nonce to put in the next ID token
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "good-code" || r.PostForm.Get("code_verifier") == "" {
+			jsonError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		p.mu.Lock()
+		nonce := p.nonce
+		p.mu.Unlock()
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken(t, nonce),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *mockProvider) setNonce(nonce string) {
+	p.mu.Lock()
+	p.nonce = nonce
+	p.mu.Unlock()
+}
+
+// idToken returns a signed ID token for Ada.
+func (p *mockProvider) idToken(t *testing.T, nonce string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	now := time.Now()
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   p.URL,
+		"sub":   "ada-123",
+		"aud":   testClientID,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": nonce,
+		"name":  "Ada Lovelace",
+		"email": "ada@example.com",
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// newTestOIDC returns sign-in in front of a handler that reports the
+// signed-in user's name, with "Bearer valid" as the only valid credential.
+func newTestOIDC(t *testing.T, p *mockProvider) http.Handler {
+	t.Helper()
+	cfg := &config.Config{
+		OIDCIssuer:      p.URL,
+		OIDCClientID:    testClientID,
+		OIDCRedirectURL: "http://pathpad.test/auth/callback",
+		OIDCScopes:      "openid profile email",
+		SessionSecret:   "test-secret",
+		SessionTTL:      time.Hour,
+	}
+	authenticated := func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer valid"
+	}
+	o, err := NewOIDC(context.Background(), cfg, authenticated)
+	if err != nil {
+		t.Fatalf("NewOIDC: %v", err)
+	}
+	return o.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := "anonymous"
+		if id := FromContext(r.Context()); id != nil {
+			name = id.Name
+		}
+		w.Write([]byte(name))
+	}))
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func findCookie(t *testing.T, w *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("response sets no %s cookie", name)
+	return nil
+}
+
+// startLogin begins a sign-in and returns the login cookie and the query of
+// the redirect to the provider.
+func startLogin(t *testing.T, h http.Handler) (*http.Cookie, url.Values) {
+	t.Helper()
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/auth/login?next=/notes", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d, want %d", w.Code, http.StatusFound)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	if query.Get("code_challenge") == "" || query.Get("state") == "" || query.Get("nonce") == "" {
+		t.Fatalf("login redirect %s lacks state, nonce or PKCE challenge", location)
+	}
+	return findCookie(t, w, loginCookie), query
+}
+
+func callback(h http.Handler, login *http.Cookie, state string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/auth/callback?code=good-code&state="+url.QueryEscape(state), nil)
+	r.AddCookie(login)
+	return serve(h, r)
+}
+
+func TestSignIn(t *testing.T) {
+	p := newMockProvider(t)
+	h := newTestOIDC(t, p)
+
+	login, query := startLogin(t, h)
+	p.setNonce(query.Get("nonce"))
+
+	w := callback(h, login, query.Get("state"))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/notes" {
+		t.Fatalf("callback: status %d to %q, want %d to /notes: %s", w.Code, w.Header().Get("Location"), http.StatusFound, w.Body)
+	}
+	session := findCookie(t, w, sessionCookie)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/pad/content/notes", nil)
+	r.AddCookie(session)
+	w = serve(h, r)
+	if w.Code != http.StatusOK || w.Body.String() != "Ada Lovelace" {
+		t.Fatalf("signed-in request: status %d, user %q; want 200 and Ada Lovelace", w.Code, w.Body)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	r.AddCookie(session)
+	w = serve(h, r)
+	var id Identity
+	if err := json.NewDecoder(w.Body).Decode(&id); err != nil || id.Subject != "ada-123" || id.Email != "ada@example.com" {
+		t.Fatalf("/auth/me = %+v, %v", id, err)
+	}
+}
+
+func TestCallbackStateMismatch(t *testing.T) {
+	p := newMockProvider(t)
+	h := newTestOIDC(t, p)
+
+	login, query := startLogin(t, h)
+	p.setNonce(query.Get("nonce"))
+
+	w := callback(h, login, "forged-state")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	assertNoSession(t, w)
+}
+
+func TestCallbackNonceMismatch(t *testing.T) {
+	p := newMockProvider(t)
+	h := newTestOIDC(t, p)
+
+	login, query := startLogin(t, h)
+	p.setNonce("replayed-nonce")
+
+	w := callback(h, login, query.Get("state"))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	assertNoSession(t, w)
+}
+
+func assertNoSession(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie && c.Value != "" {
+			t.Fatal("failed sign-in set a session cookie")
+		}
+	}
+}
+
+func TestRequestsWithoutSession(t *testing.T) {
+	p := newMockProvider(t)
+	h := newTestOIDC(t, p)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header string // Authorization header
+		want   int
+	}{
+		{"health check", http.MethodGet, "/healthz", "", http.StatusOK},
+		{"admin API", http.MethodGet, "/api/admin/rules", "", http.StatusOK},
+		{"valid credential", http.MethodPut, "/api/pad/content/notes", "Bearer valid", http.StatusOK},
+		{"no credential", http.MethodGet, "/api/pad/content/notes", "", http.StatusUnauthorized},
+		{"page", http.MethodGet, "/notes", "", http.StatusFound},
+		{"non-bearer header", http.MethodPut, "/api/pad/content/notes", "Basic eDp5", http.StatusUnauthorized},
+		{"empty bearer", http.MethodPut, "/api/pad/content/notes", "Bearer ", http.StatusUnauthorized},
+		{"invalid bearer", http.MethodPut, "/api/pad/content/notes", "Bearer pp_unknown", http.StatusUnauthorized},
+		{"empty access_token", http.MethodGet, "/api/pad/content/notes?access_token=", "", http.StatusUnauthorized},
+		{"invalid access_token", http.MethodGet, "/api/pad/events/notes?access_token=ps_forged", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader("{}"))
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := serve(h, r)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusOK && w.Body.String() != "anonymous" {
+				t.Fatalf("request without a session got user %q", w.Body)
+			}
+		})
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := map[string]string{
+		"/notes?x=1":         "/notes?x=1",
+		"":                   "/",
+		"https://evil.test/": "/",
+		"//evil.test/":       "/",
+		"/\\evil.test/":      "/",
+	}
+	for next, want := range tests {
+		if got := localPath(next); got != want {
+			t.Errorf("localPath(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
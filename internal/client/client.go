@@ -0,0 +1,233 @@
+// Package client talks to a Pathpad server over its HTTP API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"pathpad/internal/models"
+	"pathpad/internal/sse"
+)
+
+// ErrVersionConflict is returned by a conditional save when the pad was
+// changed on the server since the given version.
+var ErrVersionConflict = errors.New("pad was modified on the server")
+
+// ConfirmError is returned by DeletePad when the server wants the deletion
+// confirmed. Retry with Count as the confirmation.
+type ConfirmError struct {
+	Count int64
+}
+
+func (e *ConfirmError) Error() string {
+	return fmt.Sprintf("deletion of %d pages must be confirmed", e.Count)
+}
+
+// Client is a Pathpad API client.
+type Client struct {
+	// BaseURL is the server's address, e.g. http://localhost:8080.
+	BaseURL string
+
+	// HTTP is the client used for requests.
+	HTTP *http.Client
+
+	// Token, if set, is sent as a bearer token with every request.
+	Token string
+
+	// Name, if set, is the display name saves are attributed to.
+	Name string
+}
+
+// New creates a client for the server at baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    http.DefaultClient,
+	}
+}
+
+// GetPad fetches a pad. Pads that were never saved come back empty with
+// version 0.
+func (c *Client) GetPad(path string) (*models.Pad, error) {
+	var pad models.Pad
+	if err := c.do(http.MethodGet, c.url("content", path, nil), nil, nil, &pad); err != nil {
+		return nil, err
+	}
+	return &pad, nil
+}
+
+// SavePad saves a pad's content. If ifVersion is not nil the save only
+// succeeds while the pad is still at that version, and ErrVersionConflict is
+// returned otherwise.
+func (c *Client) SavePad(path, content string, ifVersion *int64) (*models.Pad, error) {
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if ifVersion != nil {
+		header.Set("If-Match", `"`+strconv.FormatInt(*ifVersion, 10)+`"`)
+	}
+
+	var query url.Values
+	if c.Name != "" {
+		query = url.Values{"name": {c.Name}}
+	}
+
+	var pad models.Pad
+	err = c.do(http.MethodPut, c.url("content", path, query), header, bytes.NewReader(body), &pad)
+	if err != nil {
+		return nil, err
+	}
+	return &pad, nil
+}
+
+// DeletePad deletes a pad and its descendants, returning how many pads were
+// deleted. confirm is the expected count for deletions the server wants
+// confirmed, or 0; when confirmation is missing a *ConfirmError is returned.
+func (c *Client) DeletePad(path string, confirm int64) (int64, error) {
+	query := url.Values{}
+	if confirm > 0 {
+		query.Set("confirm", strconv.FormatInt(confirm, 10))
+	}
+
+	var resp struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := c.do(http.MethodDelete, c.url("content", path, query), nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
+
+// GetChildren lists the direct children of a pad.
+func (c *Client) GetChildren(path string) ([]models.ChildPad, error) {
+	var resp struct {
+		Children []models.ChildPad `json:"children"`
+	}
+	if err := c.do(http.MethodGet, c.url("children", path, nil), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Children, nil
+}
+
+// Follow subscribes to the events of a pad and calls onEvent for each one
+// until ctx is cancelled or the connection drops. clientID identifies the
+// subscription to the server.
+func (c *Client) Follow(ctx context.Context, path, clientID string, onEvent func(sse.Event) error) error {
+	query := url.Values{"client_id": {clientID}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("events", path, query), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	c.authorize(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Update events carry the full content of a pad.
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			// Blank separators and keepalive comments.
+			continue
+		}
+		var event sse.Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("decode event: %w", err)
+		}
+		if err := onEvent(event); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// url builds the URL of a pad API operation on path.
+func (c *Client) url(op, path string, query url.Values) string {
+	u := c.BaseURL + "/api/pad/" + op
+	if path != "" {
+		u += "/" + path
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do sends a request and decodes a successful JSON response into out.
+func (c *Client) do(method, url string, header http.Header, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	c.authorize(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// authorize adds the client's token to a request.
+func (c *Client) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+}
+
+// responseError turns an error response into an error, using the message in
+// its JSON body when there is one.
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string          `json:"error"`
+		Count *int64          `json:"count"`
+		Pad   json.RawMessage `json:"pad"`
+	}
+	// Conflict responses carry the pad's current content.
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	switch {
+	case resp.StatusCode == http.StatusConflict && body.Count != nil:
+		return &ConfirmError{Count: *body.Count}
+	case resp.StatusCode == http.StatusConflict && body.Pad != nil:
+		return ErrVersionConflict
+	case body.Error != "":
+		return fmt.Errorf("%s (%s)", body.Error, resp.Status)
+	default:
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+}
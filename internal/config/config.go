@@ -10,14 +10,53 @@ import (
 // Config holds all application configuration.
 type Config struct {
 	Port            string
+	Storage         string
 	DBPath          string
+	PostgresDSN     string
+	FilesDir        string
+	FilesWatch      bool
+	MirrorDir       string
 	MaxContentSize  int64
+	MaxImportSize   int64
 	CacheTTL        time.Duration
 	RateLimit       int
 	CORSOrigins     string
 	SSEMaxClients   int
 	SSEKeepalive    time.Duration
 	LogLevel        string
+
+	// Revision history retention. Zero disables the corresponding limit.
+	HistoryMaxRevisions int
+	HistoryMaxAge       time.Duration
+
+	// How long deleted pads stay in the trash. Zero keeps them forever.
+	TrashRetention time.Duration
+
+	// Deleting root, or a pad with more descendants than this, must be
+	// confirmed.
+	DeleteConfirmThreshold int
+
+	// Bearer token for the admin API. Empty disables it.
+	AdminToken string
+
+	// How long unlocking a password-protected pad lasts.
+	UnlockTTL time.Duration
+
+	// Single sign-on. AuthMode "oidc" makes users sign in through the
+	// OpenID Connect provider at OIDCIssuer; empty leaves Pathpad open.
+	AuthMode         string
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string
+	SessionSecret    string
+	SessionTTL       time.Duration
+
+	// Scheduled backups. An empty BackupDir disables them.
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
 }
 
 // Load reads configuration from environment variables with defaults.
@@ -28,16 +67,53 @@ func Load() *Config {
 		dbPath = abs
 	}
 
+	// A PostgreSQL DSN selects the PostgreSQL backend unless told otherwise.
+	postgresDSN := os.Getenv("PATHPAD_POSTGRES_DSN")
+	defaultStorage := "sqlite"
+	if postgresDSN != "" {
+		defaultStorage = "postgres"
+	}
+
 	return &Config{
 		Port:            envOrDefault("PATHPAD_PORT", "8080"),
+		Storage:         envOrDefault("PATHPAD_STORAGE", defaultStorage),
 		DBPath:          dbPath,
+		PostgresDSN:     postgresDSN,
+		FilesDir:        envOrDefault("PATHPAD_FILES_DIR", "./pads"),
+		FilesWatch:      envOrDefaultBool("PATHPAD_FILES_WATCH", true),
+		MirrorDir:       os.Getenv("PATHPAD_MIRROR_DIR"),
 		MaxContentSize:  envOrDefaultInt64("PATHPAD_MAX_CONTENT_SIZE", 1048576),
+		MaxImportSize:   envOrDefaultInt64("PATHPAD_MAX_IMPORT_SIZE", 52428800),
 		CacheTTL:        time.Duration(envOrDefaultInt("PATHPAD_CACHE_TTL", 300)) * time.Second,
 		RateLimit:       envOrDefaultInt("PATHPAD_RATE_LIMIT", 100),
 		CORSOrigins:     envOrDefault("PATHPAD_CORS_ORIGINS", "*"),
 		SSEMaxClients:   envOrDefaultInt("PATHPAD_SSE_MAX_CLIENTS", 50),
 		SSEKeepalive:    time.Duration(envOrDefaultInt("PATHPAD_SSE_KEEPALIVE", 30)) * time.Second,
 		LogLevel:        envOrDefault("PATHPAD_LOG_LEVEL", "info"),
+
+		HistoryMaxRevisions: envOrDefaultInt("PATHPAD_HISTORY_MAX_REVISIONS", 100),
+		HistoryMaxAge:       time.Duration(envOrDefaultInt("PATHPAD_HISTORY_MAX_AGE_DAYS", 90)) * 24 * time.Hour,
+
+		TrashRetention: time.Duration(envOrDefaultInt("PATHPAD_TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+
+		DeleteConfirmThreshold: envOrDefaultInt("PATHPAD_DELETE_CONFIRM_THRESHOLD", 20),
+
+		AdminToken: os.Getenv("PATHPAD_ADMIN_TOKEN"),
+
+		UnlockTTL: time.Duration(envOrDefaultInt("PATHPAD_UNLOCK_HOURS", 24)) * time.Hour,
+
+		AuthMode:         os.Getenv("PATHPAD_AUTH_MODE"),
+		OIDCIssuer:       os.Getenv("PATHPAD_OIDC_ISSUER"),
+		OIDCClientID:     os.Getenv("PATHPAD_OIDC_CLIENT_ID"),
+		OIDCClientSecret: os.Getenv("PATHPAD_OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:  os.Getenv("PATHPAD_OIDC_REDIRECT_URL"),
+		OIDCScopes:       envOrDefault("PATHPAD_OIDC_SCOPES", "openid profile email"),
+		SessionSecret:    os.Getenv("PATHPAD_SESSION_SECRET"),
+		SessionTTL:       time.Duration(envOrDefaultInt("PATHPAD_SESSION_HOURS", 168)) * time.Hour,
+
+		BackupDir:      os.Getenv("PATHPAD_BACKUP_DIR"),
+		BackupInterval: time.Duration(envOrDefaultInt("PATHPAD_BACKUP_INTERVAL_HOURS", 24)) * time.Hour,
+		BackupKeep:     envOrDefaultInt("PATHPAD_BACKUP_KEEP", 7),
 	}
 }
 
@@ -65,3 +141,12 @@ func envOrDefaultInt64(key string, defaultVal int64) int64 {
 	}
 	return defaultVal
 }
+
+func envOrDefaultBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
@@ -0,0 +1,91 @@
+package models
+
+import "slices"
+
+// Access modes of a rule, from least to most restrictive.
+const (
+	ModePublic   = "public"    // anyone can read and write
+	ModeReadOnly = "read-only" // anyone can read, writing needs a grant
+	ModePrivate  = "private"   // reading and writing need a grant
+)
+
+// Access levels granted by tokens and share links.
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// API key scopes. Keys only get the scopes they list.
+const (
+	ScopeRead   = "read"   // read pads
+	ScopeWrite  = "write"  // create, edit, move and copy pads
+	ScopeDelete = "delete" // delete pads and pads moved away
+	ScopeAdmin  = "admin"  // use the admin API
+)
+
+// AccessRule sets what anonymous clients may do in the subtree rooted at
+// Prefix. The rule with the longest matching prefix applies; without one a
+// pad is public.
+type AccessRule struct {
+	Prefix    string `json:"prefix"`
+	Mode      string `json:"mode"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// AccessToken is a bearer token granting read or write access to the
+// subtree rooted at Prefix. Token is only set when the token is created;
+// afterwards only its hash is stored. ExpiresAt is zero for tokens that
+// don't expire.
+type AccessToken struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Prefix    string `json:"prefix"`
+	Access    string `json:"access"`
+	Token     string `json:"token,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// APIKey lets scripts use the API with the given scopes in the subtree
+// rooted at Prefix, and nowhere else. Key is only set when the key is
+// created; afterwards only its hash is stored. RateLimit is in requests per
+// minute; zero means the server's PATHPAD_RATE_LIMIT. ExpiresAt is zero for
+// keys that don't expire.
+type APIKey struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	Prefix    string   `json:"prefix"`
+	Scopes    []string `json:"scopes"`
+	RateLimit int      `json:"rate_limit,omitempty"`
+	Key       string   `json:"key,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	ExpiresAt int64    `json:"expires_at,omitempty"`
+}
+
+// HasScope reports whether the key has the given scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// ValidScope reports whether scope is a known API key scope.
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite || scope == ScopeDelete || scope == ScopeAdmin
+}
+
+// ValidMode reports whether mode is a known access mode.
+func ValidMode(mode string) bool {
+	return mode == ModePublic || mode == ModeReadOnly || mode == ModePrivate
+}
+
+// ValidAccess reports whether access is a known access level.
+func ValidAccess(access string) bool {
+	return access == AccessRead || access == AccessWrite
+}
+
+// PadLock protects the subtree rooted at Prefix with a password. Hash is the
+// encoded password hash and is never sent to clients.
+type PadLock struct {
+	Prefix    string `json:"prefix"`
+	Hash      string `json:"-"`
+	UpdatedAt int64  `json:"updated_at"`
+}
@@ -7,12 +7,18 @@ import (
 )
 
 // Pad represents a single pad document.
+// Version increases by one on every save and is 0 for implicit pads.
+// CreatedBy and UpdatedBy name who made the first and latest save; they are
+// empty when the author is unknown.
 type Pad struct {
 	Path       string `json:"path"`
 	Content    string `json:"content"`
 	ParentPath string `json:"parent_path,omitempty"`
+	Version    int64  `json:"version"`
 	UpdatedAt  int64  `json:"updated_at"`
 	CreatedAt  int64  `json:"created_at"`
+	UpdatedBy  string `json:"updated_by,omitempty"`
+	CreatedBy  string `json:"created_by,omitempty"`
 }
 
 // ChildPad is a lightweight representation for listing children.
@@ -21,6 +27,46 @@ type ChildPad struct {
 	UpdatedAt int64  `json:"updated_at"`
 }
 
+// Revision is a snapshot of a pad's content recorded on save.
+// Content is omitted when listing revisions.
+type Revision struct {
+	Path      string `json:"path"`
+	Rev       int64  `json:"rev"`
+	Content   string `json:"content,omitempty"`
+	Size      int    `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+// SearchResult is a pad matching a full-text search. Snippet is an
+// HTML-escaped excerpt of the content with matches wrapped in <mark>.
+type SearchResult struct {
+	Path      string `json:"path"`
+	Snippet   string `json:"snippet"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// TrashedPad is a deleted pad waiting in the trash. Pads deleted together
+// share a batch and are restored together.
+type TrashedPad struct {
+	ID        int64  `json:"id"`
+	Batch     int64  `json:"batch"`
+	Path      string `json:"path"`
+	Size      int    `json:"size"`
+	UpdatedAt int64  `json:"updated_at"`
+	DeletedAt int64  `json:"deleted_at"`
+}
+
+// ImportedPad reports what an import did, or would do in a dry run, with
+// one file. Status is "created", "overwritten", "renamed" or "skipped";
+// Path is where the file was stored, which differs from the requested path
+// when renamed.
+type ImportedPad struct {
+	File   string `json:"file,omitempty"`
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
 var (
 	// validSegment matches lowercase alphanumeric, hyphens, and underscores.
 	validSegment = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
@@ -0,0 +1,181 @@
+package ot
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrStale is returned when an operation's base version is no longer covered
+// by the history, e.g. because it is too old or the pad was replaced by a
+// whole-document save in the meantime. The client has to resync.
+var ErrStale = errors.New("base version is no longer available")
+
+// idlePads is how many pads nobody is editing keep their history. Beyond
+// that the least recently edited ones are dropped; their next operation
+// either has an up-to-date base version or has to resync.
+const idlePads = 1000
+
+// History keeps the most recent operations applied to each pad, so that an
+// operation made against an older version can be transformed to apply on
+// top of the current one. It also serializes operations per pad.
+type History struct {
+	mu    sync.Mutex
+	pads  map[string]*padHistory
+	idle  *list.List // unlocked pads, least recently used first
+	limit int
+}
+
+type padHistory struct {
+	mu   sync.Mutex
+	base int64       // pad version before ops[0] was applied
+	ops  []Operation // ops[i] took the pad from version base+i to base+i+1
+
+	// Guarded by History.mu.
+	path      string
+	users     int           // callers holding or waiting for mu
+	elem      *list.Element // position in History.idle while users is 0
+	forgotten bool          // dropped by Forget while in use
+}
+
+// NewHistory creates a history keeping up to limit operations per pad.
+func NewHistory(limit int) *History {
+	return &History{
+		pads:  make(map[string]*padHistory),
+		idle:  list.New(),
+		limit: limit,
+	}
+}
+
+// Lock serializes operations on a pad. The returned function releases the
+// lock. Rebase and Record must only be called while holding it.
+func (h *History) Lock(path string) func() {
+	h.mu.Lock()
+	ph, ok := h.pads[path]
+	if !ok {
+		ph = &padHistory{path: path}
+		h.pads[path] = ph
+	}
+	if ph.elem != nil {
+		h.idle.Remove(ph.elem)
+		ph.elem = nil
+	}
+	ph.users++
+	h.mu.Unlock()
+
+	ph.mu.Lock()
+	return func() {
+		ph.mu.Unlock()
+		h.release(ph)
+	}
+}
+
+// release marks ph idle once its last user is done, and drops the least
+// recently used idle pads beyond idlePads.
+func (h *History) release(ph *padHistory) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ph.users--
+	if ph.users > 0 {
+		return
+	}
+	if ph.forgotten {
+		delete(h.pads, ph.path)
+		return
+	}
+	ph.elem = h.idle.PushBack(ph)
+	for h.idle.Len() > idlePads {
+		h.drop(h.idle.Front().Value.(*padHistory))
+	}
+}
+
+// drop removes an idle pad. The caller must hold h.mu.
+func (h *History) drop(ph *padHistory) {
+	h.idle.Remove(ph.elem)
+	ph.elem = nil
+	delete(h.pads, ph.path)
+}
+
+// Forget drops the history of a pad and its descendants, e.g. because they
+// were deleted or moved. Operations made against their old versions have to
+// resync. An empty path forgets every pad.
+func (h *History) Forget(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for p, ph := range h.pads {
+		if !inSubtree(p, path) {
+			continue
+		}
+		if ph.users > 0 {
+			// Dropped on release, so that callers waiting for its lock
+			// still serialize on it.
+			ph.forgotten = true
+			continue
+		}
+		h.drop(ph)
+	}
+}
+
+// inSubtree reports whether path is root or one of its descendants.
+func inSubtree(path, root string) bool {
+	return root == "" || path == root || strings.HasPrefix(path, root+"/")
+}
+
+// lookup returns the history of a pad, or nil if it was forgotten.
+func (h *History) lookup(path string) *padHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ph := h.pads[path]
+	if ph == nil || ph.forgotten {
+		return nil
+	}
+	return ph
+}
+
+// Rebase transforms op, made against baseVersion, so that it applies to the
+// pad at currentVersion. Returns ErrStale if the operations in between are
+// not known.
+func (h *History) Rebase(path string, op Operation, baseVersion, currentVersion int64) (Operation, error) {
+	if baseVersion == currentVersion {
+		return op, nil
+	}
+
+	ph := h.lookup(path)
+	if ph == nil || baseVersion > currentVersion || baseVersion < ph.base ||
+		ph.base+int64(len(ph.ops)) != currentVersion {
+		return nil, ErrStale
+	}
+
+	for _, applied := range ph.ops[baseVersion-ph.base:] {
+		var err error
+		op, _, err = Transform(op, applied)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// Record appends op as the change that produced version. If the pad was
+// changed by other means since the last recorded operation, the history
+// restarts at this operation.
+func (h *History) Record(path string, op Operation, version int64) {
+	ph := h.lookup(path)
+	if ph == nil {
+		return
+	}
+
+	if ph.base+int64(len(ph.ops)) != version-1 {
+		ph.base = version - 1
+		ph.ops = nil
+	}
+	ph.ops = append(ph.ops, op)
+
+	if over := len(ph.ops) - h.limit; over > 0 {
+		ph.ops = append([]Operation(nil), ph.ops[over:]...)
+		ph.base += int64(over)
+	}
+}
@@ -0,0 +1,123 @@
+package ot
+
+import (
+	"fmt"
+	"testing"
+)
+
+// record locks path and records ops as the versions after from.
+func record(h *History, path string, from int64, ops ...Operation) {
+	unlock := h.Lock(path)
+	defer unlock()
+	for i, o := range ops {
+		h.Record(path, o, from+int64(i)+1)
+	}
+}
+
+func rebase(h *History, path string, o Operation, base, current int64) (Operation, error) {
+	unlock := h.Lock(path)
+	defer unlock()
+	return h.Rebase(path, o, base, current)
+}
+
+func TestRebase(t *testing.T) {
+	h := NewHistory(2)
+	// "abc" at version 1 became "Xabc" at 2 and "Xabc!" at 3.
+	record(h, "notes", 1, op("X", 3), op(4, "!"))
+
+	rebased, err := rebase(h, "notes", op(1, -1, 1), 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustApply(t, "Xabc!", rebased); got != "Xac!" {
+		t.Errorf("rebased onto version 3: %q, want Xac!", got)
+	}
+	rebased, err = rebase(h, "notes", op(4, "?"), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustApply(t, "Xabc!", rebased); got != "Xabc?!" {
+		t.Errorf("rebased onto version 3: %q, want Xabc?!", got)
+	}
+	if o, err := rebase(h, "notes", op(5), 3, 3); err != nil || len(o) != 1 {
+		t.Errorf("rebase onto the same version = %v, %v", o, err)
+	}
+
+	// Version 4 pushes version 1 out of the two-operation history.
+	record(h, "notes", 3, op(5, "?"))
+
+	for _, tt := range []struct {
+		name          string
+		path          string
+		base, current int64
+	}{
+		{"base older than history", "notes", 1, 4},
+		{"base newer than current", "notes", 5, 4},
+		{"current ahead of history", "notes", 2, 5},
+		{"unknown pad", "other", 1, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rebase(h, tt.path, op(3), tt.base, tt.current); err != ErrStale {
+				t.Errorf("Rebase = %v, want ErrStale", err)
+			}
+		})
+	}
+
+	// A whole-document save to version 5 leaves a gap; the history restarts.
+	record(h, "notes", 5, op(6, "."))
+	if _, err := rebase(h, "notes", op(5), 4, 6); err != ErrStale {
+		t.Errorf("rebase across a gap = %v, want ErrStale", err)
+	}
+	if _, err := rebase(h, "notes", op(6), 5, 6); err != nil {
+		t.Errorf("rebase after the gap: %v", err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	h := NewHistory(10)
+	for _, path := range []string{"a", "a/b", "ab"} {
+		record(h, path, 1, op(1))
+	}
+
+	h.Forget("a")
+	for path, want := range map[string]error{"a": ErrStale, "a/b": ErrStale, "ab": nil} {
+		if _, err := rebase(h, path, op(1), 1, 2); err != want {
+			t.Errorf("Rebase(%s) after forgetting a = %v, want %v", path, err, want)
+		}
+	}
+
+	unlock := h.Lock("ab")
+	h.Forget("")
+	if _, err := h.Rebase("ab", op(1), 1, 2); err != ErrStale {
+		t.Errorf("Rebase of a locked pad after forgetting it = %v, want ErrStale", err)
+	}
+	unlock()
+	if len(h.pads) != 0 {
+		t.Errorf("%d pads left after forgetting root", len(h.pads))
+	}
+}
+
+func TestIdlePadsEvicted(t *testing.T) {
+	h := NewHistory(10)
+	unlock := h.Lock("busy")
+	h.Record("busy", op(1), 2)
+
+	for i := 0; i < idlePads+50; i++ {
+		record(h, fmt.Sprint("pad", i), 1, op(1))
+	}
+	if got := len(h.pads); got != idlePads+1 {
+		t.Errorf("%d pads kept, want %d idle ones plus the locked one", got, idlePads)
+	}
+	if _, err := h.Rebase("busy", op(1), 1, 2); err != nil {
+		t.Errorf("locked pad was evicted: %v", err)
+	}
+	unlock()
+
+	if _, err := rebase(h, "pad0", op(1), 1, 2); err != ErrStale {
+		t.Errorf("least recently used pad kept: %v", err)
+	}
+	last := fmt.Sprint("pad", idlePads+49)
+	if _, err := rebase(h, last, op(1), 1, 2); err != nil {
+		t.Errorf("most recently used pad evicted: %v", err)
+	}
+}
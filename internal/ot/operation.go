@@ -0,0 +1,275 @@
+// Package ot implements operational transformation for plain-text pads.
+//
+// An Operation walks the whole document from start to end as a sequence of
+// components: retain n characters, insert a string, or delete n characters.
+// Lengths are counted in Unicode code points. In JSON an operation is an
+// array where positive integers retain, negative integers delete, and
+// strings insert, e.g. [5, "hello", -3, 10].
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrLengthMismatch is returned when an operation doesn't span the whole
+// document it is applied or transformed against.
+var ErrLengthMismatch = errors.New("operation length does not match document")
+
+// Component is a single step of an operation. Exactly one field is set.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Operation is a sequence of components transforming one document into
+// another.
+type Operation []Component
+
+// Retain appends a retain of n characters, merging with a preceding retain.
+func (op *Operation) Retain(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(*op) - 1; last >= 0 && (*op)[last].Retain > 0 {
+		(*op)[last].Retain += n
+		return
+	}
+	*op = append(*op, Component{Retain: n})
+}
+
+// Insert appends an insertion. Inserts are kept in front of an adjacent
+// delete so that equivalent operations have the same representation.
+func (op *Operation) Insert(s string) {
+	if s == "" {
+		return
+	}
+	ops := *op
+	last := len(ops) - 1
+	if last >= 0 && ops[last].Insert != "" {
+		ops[last].Insert += s
+		return
+	}
+	if last >= 0 && ops[last].Delete > 0 {
+		if last > 0 && ops[last-1].Insert != "" {
+			ops[last-1].Insert += s
+			return
+		}
+		*op = append(ops[:last], Component{Insert: s}, ops[last])
+		return
+	}
+	*op = append(ops, Component{Insert: s})
+}
+
+// Delete appends a deletion of n characters, merging with a preceding delete.
+func (op *Operation) Delete(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(*op) - 1; last >= 0 && (*op)[last].Delete > 0 {
+		(*op)[last].Delete += n
+		return
+	}
+	*op = append(*op, Component{Delete: n})
+}
+
+// BaseLen returns the length of the document the operation applies to.
+func (op Operation) BaseLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLen returns the length of the document the operation produces.
+func (op Operation) TargetLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + utf8.RuneCountInString(c.Insert)
+	}
+	return n
+}
+
+// IsNoop reports whether the operation leaves the document unchanged.
+func (op Operation) IsNoop() bool {
+	for _, c := range op {
+		if c.Retain == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply applies the operation to doc and returns the resulting document.
+func Apply(doc string, op Operation) (string, error) {
+	runes := []rune(doc)
+	if op.BaseLen() != len(runes) {
+		return "", ErrLengthMismatch
+	}
+
+	out := make([]rune, 0, op.TargetLen())
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			out = append(out, runes[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Insert != "":
+			out = append(out, []rune(c.Insert)...)
+		case c.Delete > 0:
+			pos += c.Delete
+		}
+	}
+	return string(out), nil
+}
+
+// Transform takes two operations a and b made concurrently against the same
+// document and returns a' and b' such that applying a then b' yields the same
+// document as applying b then a'. When both insert at the same position, a's
+// insertion ends up first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, ErrLengthMismatch
+	}
+
+	var aPrime, bPrime Operation
+	i, j := 0, 0
+	var ca, cb *Component
+	next := func(op Operation, idx *int) *Component {
+		if *idx >= len(op) {
+			return nil
+		}
+		c := op[*idx]
+		*idx++
+		return &c
+	}
+	ca, cb = next(a, &i), next(b, &j)
+
+	for ca != nil || cb != nil {
+		if ca != nil && ca.Insert != "" {
+			aPrime.Insert(ca.Insert)
+			bPrime.Retain(utf8.RuneCountInString(ca.Insert))
+			ca = next(a, &i)
+			continue
+		}
+		if cb != nil && cb.Insert != "" {
+			aPrime.Retain(utf8.RuneCountInString(cb.Insert))
+			bPrime.Insert(cb.Insert)
+			cb = next(b, &j)
+			continue
+		}
+		if ca == nil || cb == nil {
+			return nil, nil, ErrLengthMismatch
+		}
+
+		// Both components are now retains or deletes; consume the shorter.
+		la, lb := ca.Retain+ca.Delete, cb.Retain+cb.Delete
+		n := min(la, lb)
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case ca.Delete > 0 && cb.Retain > 0:
+			aPrime.Delete(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			bPrime.Delete(n)
+		}
+		// Deleted by both: nothing to emit.
+
+		if la == n {
+			ca = next(a, &i)
+		} else {
+			shrink(ca, n)
+		}
+		if lb == n {
+			cb = next(b, &j)
+		} else {
+			shrink(cb, n)
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// shrink shortens a retain or delete component by n characters.
+func shrink(c *Component, n int) {
+	if c.Retain > 0 {
+		c.Retain -= n
+	} else {
+		c.Delete -= n
+	}
+}
+
+// Diff returns an operation that turns oldDoc into newDoc by replacing the
+// region between their common prefix and suffix.
+func Diff(oldDoc, newDoc string) Operation {
+	a, b := []rune(oldDoc), []rune(newDoc)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var op Operation
+	op.Retain(prefix)
+	op.Insert(string(b[prefix : len(b)-suffix]))
+	op.Delete(len(a) - prefix - suffix)
+	op.Retain(suffix)
+	return op
+}
+
+// MarshalJSON encodes the operation in the compact array form.
+func (op Operation) MarshalJSON() ([]byte, error) {
+	parts := make([]interface{}, 0, len(op))
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			parts = append(parts, c.Retain)
+		case c.Insert != "":
+			parts = append(parts, c.Insert)
+		case c.Delete > 0:
+			parts = append(parts, -c.Delete)
+		}
+	}
+	return json.Marshal(parts)
+}
+
+// UnmarshalJSON decodes the compact array form, normalizing the result.
+func (op *Operation) UnmarshalJSON(data []byte) error {
+	var parts []interface{}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+
+	var out Operation
+	for _, p := range parts {
+		switch v := p.(type) {
+		case string:
+			if v == "" {
+				return errors.New("operation contains an empty insert")
+			}
+			out.Insert(v)
+		case float64:
+			n := int(v)
+			if float64(n) != v || n == 0 {
+				return fmt.Errorf("invalid operation component %v", v)
+			}
+			if n > 0 {
+				out.Retain(n)
+			} else {
+				out.Delete(-n)
+			}
+		default:
+			return fmt.Errorf("invalid operation component %v", p)
+		}
+	}
+	*op = out
+	return nil
+}
@@ -0,0 +1,189 @@
+package ot
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+)
+
+// op builds an operation from retains (positive ints), deletes (negative
+// ints) and inserts (strings).
+func op(parts ...interface{}) Operation {
+	var o Operation
+	for _, p := range parts {
+		switch v := p.(type) {
+		case string:
+			o.Insert(v)
+		case int:
+			if v > 0 {
+				o.Retain(v)
+			} else {
+				o.Delete(-v)
+			}
+		}
+	}
+	return o
+}
+
+func mustApply(t *testing.T, doc string, o Operation) string {
+	t.Helper()
+	out, err := Apply(doc, o)
+	if err != nil {
+		t.Fatalf("Apply(%q, %v): %v", doc, o, err)
+	}
+	return out
+}
+
+// converge checks TP1 for a and b on doc and returns the common result.
+func converge(t *testing.T, doc string, a, b Operation) string {
+	t.Helper()
+	aPrime, bPrime, err := Transform(a, b)
+	if err != nil {
+		t.Fatalf("Transform(%v, %v): %v", a, b, err)
+	}
+	ab := mustApply(t, mustApply(t, doc, a), bPrime)
+	ba := mustApply(t, mustApply(t, doc, b), aPrime)
+	if ab != ba {
+		t.Fatalf("a then b' = %q, b then a' = %q", ab, ba)
+	}
+	return ab
+}
+
+func TestApply(t *testing.T) {
+	if got := mustApply(t, "hello world", op(6, -5, "pads")); got != "hello pads" {
+		t.Errorf("got %q", got)
+	}
+	if got := mustApply(t, "héllo", op(1, -1, "e", 3)); got != "hello" {
+		t.Errorf("code points: got %q", got)
+	}
+	if _, err := Apply("short", op(10)); err != ErrLengthMismatch {
+		t.Errorf("length mismatch: %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b Operation
+		want string
+	}{
+		{"inserts at different positions", "abc", op(1, "X", 2), op(2, "Y", 1), "aXbYc"},
+		{"same-position inserts put a first", "abc", op(1, "X", 2), op(1, "Y", 2), "aXYbc"},
+		{"same-position inserts at the start", "abc", op("X", 3), op("Y", 3), "XYabc"},
+		{"same-position inserts at the end", "abc", op(3, "X"), op(3, "Y"), "abcXY"},
+		{"overlapping deletes", "abcdef", op(1, -3, 2), op(2, -3, 1), "af"},
+		{"same delete", "abcdef", op(1, -2, 3), op(1, -2, 3), "adef"},
+		{"insert inside a deleted range", "abcdef", op(1, -4, 1), op(3, "X", 3), "aXf"},
+		{"replace against replace", "hello world", op(6, "pads", -5), op(-5, "goodbye", 6), "goodbye pads"},
+		{"empty document", "", op("X"), op("Y"), "XY"},
+		{"multi-byte text", "héllo", op(1, -1, "e", 3), op(5, " wörld"), "hello wörld"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := converge(t, tt.doc, tt.a, tt.b); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The tie-break follows argument order, not content.
+	if got := converge(t, "abc", op(1, "Y", 2), op(1, "X", 2)); got != "aYXbc" {
+		t.Errorf("swapped same-position inserts: got %q, want aYXbc", got)
+	}
+
+	if _, _, err := Transform(op(3), op(4)); err != ErrLengthMismatch {
+		t.Errorf("different base lengths: %v", err)
+	}
+}
+
+// randomOp returns a random operation on doc.
+func randomOp(rng *rand.Rand, doc string) Operation {
+	var o Operation
+	n := utf8.RuneCountInString(doc)
+	for pos := 0; pos < n; {
+		k := 1 + rng.Intn(n-pos)
+		switch rng.Intn(3) {
+		case 0:
+			o.Retain(k)
+			pos += k
+		case 1:
+			o.Delete(k)
+			pos += k
+		default:
+			o.Insert(randomText(rng))
+		}
+	}
+	if rng.Intn(2) == 0 {
+		o.Insert(randomText(rng))
+	}
+	return o
+}
+
+func randomText(rng *rand.Rand) string {
+	const alphabet = "abcxyzé€ \n"
+	runes := []rune(alphabet)
+	out := make([]rune, 1+rng.Intn(4))
+	for i := range out {
+		out[i] = runes[rng.Intn(len(runes))]
+	}
+	return string(out)
+}
+
+func TestTransformRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		doc := randomText(rng) + randomText(rng) + randomText(rng)
+		converge(t, doc, randomOp(rng, doc), randomOp(rng, doc))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct{ old, new string }{
+		{"", ""},
+		{"", "hello"},
+		{"hello", ""},
+		{"hello", "hello"},
+		{"hello world", "hello pads"},
+		{"abc", "abXc"},
+		{"aaaa", "aa"},
+		{"héllo wörld", "hello wörld"},
+		{"line one\nline two\n", "line one\nline 2\nline three\n"},
+	}
+	for _, tt := range tests {
+		o := Diff(tt.old, tt.new)
+		if got := mustApply(t, tt.old, o); got != tt.new {
+			t.Errorf("Apply(%q, Diff) = %q, want %q", tt.old, got, tt.new)
+		}
+		if tt.old == tt.new && !o.IsNoop() {
+			t.Errorf("Diff of equal documents %q = %v, want a no-op", tt.old, o)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		oldDoc := randomText(rng) + randomText(rng)
+		newDoc := mustApply(t, oldDoc, randomOp(rng, oldDoc))
+		if got := mustApply(t, oldDoc, Diff(oldDoc, newDoc)); got != newDoc {
+			t.Fatalf("Apply(%q, Diff) = %q, want %q", oldDoc, got, newDoc)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	o := op(5, "hi", -3, 2)
+	data, err := json.Marshal(o)
+	if err != nil || string(data) != `[5,"hi",-3,2]` {
+		t.Fatalf("Marshal = %s, %v", data, err)
+	}
+	var back Operation
+	if err := json.Unmarshal(data, &back); err != nil || mustApply(t, "abcdefghij", back) != mustApply(t, "abcdefghij", o) {
+		t.Fatalf("Unmarshal = %v, %v", back, err)
+	}
+	for _, bad := range []string{`[0]`, `[1.5]`, `[""]`, `[true]`, `{}`} {
+		if err := json.Unmarshal([]byte(bad), &back); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", bad)
+		}
+	}
+}
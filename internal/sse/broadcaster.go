@@ -7,14 +7,20 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"pathpad/internal/ot"
 )
 
 // Event represents an SSE event sent to clients.
 type Event struct {
-	Type     string `json:"type"`               // "update" or "delete"
-	Content  string `json:"content,omitempty"`   // pad content (for update events)
-	Path     string `json:"path,omitempty"`      // pad path (for delete events)
-	ClientID string `json:"client_id,omitempty"` // sender's client ID
+	Type        string       `json:"type"`                  // "update", "op", "delete", "moved" or "children_changed"
+	Content     string       `json:"content,omitempty"`     // pad content (for update events without ops)
+	Path        string       `json:"path,omitempty"`        // pad path (for delete and moved events)
+	Destination string       `json:"destination,omitempty"` // new pad path (for moved events)
+	Version     int64        `json:"version,omitempty"`     // pad version after the change (for update and op events)
+	Ops         ot.Operation `json:"ops,omitempty"`         // applied operation (for op events and patch updates)
+	UpdatedBy   string       `json:"updated_by,omitempty"`  // author of the change (for update and op events)
+	ClientID    string       `json:"client_id,omitempty"`   // sender's client ID
 }
 
 // Broadcaster manages SSE connections and event distribution.
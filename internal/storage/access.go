@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+var (
+	// ErrRuleNotFound is returned when deleting an access rule that doesn't
+	// exist.
+	ErrRuleNotFound = errors.New("access rule not found")
+
+	// ErrTokenNotFound is returned when deleting an access token that doesn't
+	// exist.
+	ErrTokenNotFound = errors.New("access token not found")
+
+	// ErrAPIKeyNotFound is returned when deleting an API key that doesn't
+	// exist.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+
+	// ErrLockNotFound is returned when removing a password lock that doesn't
+	// exist.
+	ErrLockNotFound = errors.New("pad lock not found")
+)
+
+// ListAccessRules returns all access rules, sorted by prefix.
+func (s *SQLiteStore) ListAccessRules() ([]models.AccessRule, error) {
+	rows, err := s.db.Query(`SELECT prefix, mode, updated_at FROM access_rules ORDER BY prefix ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list access rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.AccessRule{}
+	for rows.Next() {
+		var rule models.AccessRule
+		if err := rows.Scan(&rule.Prefix, &rule.Mode, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan access rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate access rules: %w", err)
+	}
+	return rules, nil
+}
+
+// SetAccessRule creates or replaces the rule for a prefix.
+func (s *SQLiteStore) SetAccessRule(prefix, mode string) (*models.AccessRule, error) {
+	rule := &models.AccessRule{Prefix: prefix, Mode: mode, UpdatedAt: time.Now().Unix()}
+	_, err := s.db.Exec(`
+		INSERT INTO access_rules (prefix, mode, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(prefix) DO UPDATE SET mode = excluded.mode, updated_at = excluded.updated_at
+	`, rule.Prefix, rule.Mode, rule.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("set access rule %q: %w", prefix, err)
+	}
+	return rule, nil
+}
+
+// DeleteAccessRule removes the rule for a prefix. Returns ErrRuleNotFound if
+// there is none.
+func (s *SQLiteStore) DeleteAccessRule(prefix string) error {
+	result, err := s.db.Exec(`DELETE FROM access_rules WHERE prefix = ?`, prefix)
+	if err != nil {
+		return fmt.Errorf("delete access rule %q: %w", prefix, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// CreateAccessToken stores a new token under the hash of its secret and sets
+// its ID and creation time.
+func (s *SQLiteStore) CreateAccessToken(token *models.AccessToken, hash string) error {
+	token.CreatedAt = time.Now().Unix()
+	result, err := s.db.Exec(`
+		INSERT INTO access_tokens (name, token_hash, prefix, access, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, token.Name, hash, token.Prefix, token.Access, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create access token: %w", err)
+	}
+	if token.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("create access token: %w", err)
+	}
+	return nil
+}
+
+// ListAccessTokens returns all tokens, oldest first, without their secrets.
+func (s *SQLiteStore) ListAccessTokens() ([]models.AccessToken, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, prefix, access, created_at, expires_at
+		FROM access_tokens ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.AccessToken{}
+	for rows.Next() {
+		var t models.AccessToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.Access, &t.CreatedAt, &t.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan access token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate access tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// LookupAccessToken finds the unexpired token with the given hash. Returns
+// nil if there is none.
+func (s *SQLiteStore) LookupAccessToken(hash string) (*models.AccessToken, error) {
+	var t models.AccessToken
+	err := s.db.QueryRow(`
+		SELECT id, name, prefix, access, created_at, expires_at
+		FROM access_tokens WHERE token_hash = ? AND (expires_at = 0 OR expires_at > ?)
+	`, hash, time.Now().Unix()).Scan(&t.ID, &t.Name, &t.Prefix, &t.Access, &t.CreatedAt, &t.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("look up access token: %w", err)
+	}
+	return &t, nil
+}
+
+// DeleteAccessToken revokes a token. Returns ErrTokenNotFound if it doesn't
+// exist.
+func (s *SQLiteStore) DeleteAccessToken(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM access_tokens WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete access token %d: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key under the hash of its secret and sets
+// its ID and creation time.
+func (s *SQLiteStore) CreateAPIKey(key *models.APIKey, hash string) error {
+	key.CreatedAt = time.Now().Unix()
+	result, err := s.db.Exec(`
+		INSERT INTO api_keys (name, key_hash, prefix, scopes, rate_limit, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, key.Name, hash, key.Prefix, strings.Join(key.Scopes, ","), key.RateLimit, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create API key: %w", err)
+	}
+	if key.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("create API key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys returns all API keys, oldest first, without their secrets.
+func (s *SQLiteStore) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, prefix, scopes, rate_limit, created_at, expires_at
+		FROM api_keys ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var scopes string
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.RateLimit, &k.CreatedAt, &k.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan API key: %w", err)
+		}
+		k.Scopes = splitScopes(scopes)
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// LookupAPIKey finds the unexpired API key with the given hash. Returns nil
+// if there is none.
+func (s *SQLiteStore) LookupAPIKey(hash string) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	err := s.db.QueryRow(`
+		SELECT id, name, prefix, scopes, rate_limit, created_at, expires_at
+		FROM api_keys WHERE key_hash = ? AND (expires_at = 0 OR expires_at > ?)
+	`, hash, time.Now().Unix()).Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.RateLimit, &k.CreatedAt, &k.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("look up API key: %w", err)
+	}
+	k.Scopes = splitScopes(scopes)
+	return &k, nil
+}
+
+// DeleteAPIKey revokes an API key. Returns ErrAPIKeyNotFound if it doesn't
+// exist.
+func (s *SQLiteStore) DeleteAPIKey(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete API key %d: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// splitScopes parses the comma-separated scopes column.
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// ListPadLocks returns all password locks, including their password hashes,
+// sorted by prefix.
+func (s *SQLiteStore) ListPadLocks() ([]models.PadLock, error) {
+	rows, err := s.db.Query(`SELECT prefix, password_hash, updated_at FROM pad_locks ORDER BY prefix ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list pad locks: %w", err)
+	}
+	defer rows.Close()
+
+	locks := []models.PadLock{}
+	for rows.Next() {
+		var lock models.PadLock
+		if err := rows.Scan(&lock.Prefix, &lock.Hash, &lock.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan pad lock: %w", err)
+		}
+		locks = append(locks, lock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pad locks: %w", err)
+	}
+	return locks, nil
+}
+
+// SetPadLock sets or replaces the password hash protecting a prefix.
+func (s *SQLiteStore) SetPadLock(prefix, hash string) (*models.PadLock, error) {
+	lock := &models.PadLock{Prefix: prefix, Hash: hash, UpdatedAt: time.Now().Unix()}
+	_, err := s.db.Exec(`
+		INSERT INTO pad_locks (prefix, password_hash, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(prefix) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at
+	`, lock.Prefix, lock.Hash, lock.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("set pad lock %q: %w", prefix, err)
+	}
+	return lock, nil
+}
+
+// DeletePadLock removes the password from a prefix. Returns ErrLockNotFound
+// if it has none.
+func (s *SQLiteStore) DeletePadLock(prefix string) error {
+	result, err := s.db.Exec(`DELETE FROM pad_locks WHERE prefix = ?`, prefix)
+	if err != nil {
+		return fmt.Errorf("delete pad lock %q: %w", prefix, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrLockNotFound
+	}
+	return nil
+}
+
+// Setting returns a stored setting, or "" if it isn't set.
+func (s *SQLiteStore) Setting(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get setting %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSetting stores a setting.
+func (s *SQLiteStore) SetSetting(key, value string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	if err != nil {
+		return fmt.Errorf("set setting %q: %w", key, err)
+	}
+	return nil
+}
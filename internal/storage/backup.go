@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Scheduled backups are named backupPrefix + timestamp + backupSuffix, so
+// sorting the names sorts them by age.
+const (
+	backupPrefix     = "pathpad-"
+	backupSuffix     = ".db"
+	backupTimeFormat = "20060102-150405"
+)
+
+// Backup writes a consistent snapshot of the live database to destPath using
+// SQLite's online backup API. Writers aren't blocked while it runs. The
+// snapshot is written to a temporary file first, so destPath never holds a
+// partial backup.
+func (s *SQLiteStore) Backup(destPath string) error {
+	tmpPath := destPath + ".tmp"
+	os.Remove(tmpPath)
+	defer os.Remove(tmpPath)
+
+	if err := s.backupTo(tmpPath); err != nil {
+		return fmt.Errorf("backup to %q: %w", destPath, err)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("backup to %q: %w", destPath, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) backupTo(destPath string) error {
+	ctx := context.Background()
+
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			dest := destDriverConn.(*sqlite3.SQLiteConn)
+			src := srcDriverConn.(*sqlite3.SQLiteConn)
+
+			backup, err := dest.Backup("main", src, "main")
+			if err != nil {
+				return err
+			}
+			// Copy all pages in one step so the snapshot is taken from a
+			// single read transaction.
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// BackupToDir writes a timestamped backup into dir and then deletes the
+// oldest backups there so that at most keep remain. keep <= 0 keeps all of
+// them. Returns the path of the new backup.
+func (s *SQLiteStore) BackupToDir(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create backup directory %q: %w", dir, err)
+	}
+
+	name := backupPrefix + time.Now().UTC().Format(backupTimeFormat) + backupSuffix
+	destPath := filepath.Join(dir, name)
+	if err := s.Backup(destPath); err != nil {
+		return "", err
+	}
+
+	if keep > 0 {
+		if err := rotateBackups(dir, keep); err != nil {
+			return destPath, err
+		}
+	}
+	return destPath, nil
+}
+
+// rotateBackups deletes all but the newest keep scheduled backups in dir.
+// Other files are left alone.
+func rotateBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("list backups in %q: %w", dir, err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix)
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		backups = append(backups, name)
+	}
+	sort.Strings(backups)
+
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return fmt.Errorf("remove old backup %q: %w", backups[0], err)
+		}
+		log.Printf("[db] Removed old backup %s", backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
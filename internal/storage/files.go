@@ -0,0 +1,531 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// indexFile holds the content of a pad stored in directory form.
+const indexFile = "index.md"
+
+// FileStore keeps pads as Markdown files under a root directory, so they can
+// be grepped, edited and committed to git. Pad a/b/c is stored in a/b/c.md,
+// or in a/b/c/index.md once it has descendants. The root pad is index.md in
+// the root directory. Files and directories that don't map to a valid pad
+// path are left alone.
+//
+// Files carry no version, so versions are tracked in memory and start over
+// at 1 when the process restarts. Changing a file outside of Pathpad bumps
+// its version the next time it is read. The author of the latest save is
+// kept in memory the same way; creators aren't recorded.
+type FileStore struct {
+	mu       sync.Mutex
+	root     string
+	versions map[string]fileVersion
+
+	// Pads found changed on disk by a read that Watch hasn't reported yet.
+	changed map[string]bool
+
+	// Versions of deleted pads, which pads created later at the same path
+	// continue from.
+	vacated map[string]int64
+}
+
+// fileVersion is the last seen state of a pad file.
+type fileVersion struct {
+	version int64
+	modTime time.Time
+	size    int64
+	author  string // who saved it through Pathpad; empty if changed outside
+}
+
+// NewFileStore opens a file store rooted at dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create pads directory %q: %w", dir, err)
+	}
+	return &FileStore{
+		root:     dir,
+		versions: make(map[string]fileVersion),
+		changed:  make(map[string]bool),
+		vacated:  make(map[string]int64),
+	}, nil
+}
+
+// Ping checks that the root directory is still accessible.
+func (s *FileStore) Ping() error {
+	info, err := os.Stat(s.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.root)
+	}
+	return nil
+}
+
+// Close is a no-op.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// GetPad retrieves a pad by path. Returns an implicit pad if no file exists.
+func (s *FileStore) GetPad(path string) (*models.Pad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getPad(path)
+}
+
+func (s *FileStore) getPad(path string) (*models.Pad, error) {
+	pad := &models.Pad{Path: path, ParentPath: models.ParentPath(path)}
+
+	file, info, err := s.findPad(path)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		return pad, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("get pad %q: %w", path, err)
+	}
+	pad.Content = string(content)
+	pad.Version = s.observe(path, info)
+	pad.UpdatedBy = s.versions[path].author
+	// The filesystem doesn't record creation times portably.
+	pad.UpdatedAt = info.ModTime().Unix()
+	pad.CreatedAt = pad.UpdatedAt
+	return pad, nil
+}
+
+// SavePad writes a pad's content, bumping its version.
+func (s *FileStore) SavePad(path, content, author string) (*models.Pad, error) {
+	return s.savePad(path, content, nil, author)
+}
+
+// SavePadIfVersion saves a pad only if its current version equals
+// expectedVersion (0 for a pad that doesn't exist yet). Returns
+// ErrVersionConflict otherwise.
+func (s *FileStore) SavePadIfVersion(path, content string, expectedVersion int64, author string) (*models.Pad, error) {
+	return s.savePad(path, content, &expectedVersion, author)
+}
+
+func (s *FileStore) savePad(path, content string, expectedVersion *int64, author string) (*models.Pad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.getPad(path)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != nil && *expectedVersion != current.Version {
+		return nil, ErrVersionConflict
+	}
+
+	// Ancestors stored as plain files now have a descendant and move into
+	// directory form.
+	for ancestor := models.ParentPath(path); ancestor != ""; ancestor = models.ParentPath(ancestor) {
+		if err := s.toDirForm(ancestor); err != nil {
+			return nil, err
+		}
+	}
+
+	file := s.flatFile(path)
+	if !hasFlatForm(path) || isDir(s.dirOf(path)) {
+		file = filepath.Join(s.dirOf(path), indexFile)
+	}
+	if err := writeFileAtomic(file, []byte(content)); err != nil {
+		return nil, fmt.Errorf("save pad %q: %w", path, err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("save pad %q: %w", path, err)
+	}
+	version := max(current.Version, s.vacated[path]) + 1
+	s.versions[path] = fileVersion{version: version, modTime: info.ModTime(), size: info.Size(), author: author}
+	delete(s.changed, path)
+
+	return s.getPad(path)
+}
+
+// DeletePad deletes a pad and all its descendants. Returns the count of
+// deleted pads.
+func (s *FileStore) DeletePad(path string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	err := s.walkPads(path, func(padPath, file string) error {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		s.forget(padPath)
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("delete pad %q: %w", path, err)
+	}
+
+	// Drop directories left empty, then move ancestors without any other
+	// descendants back to plain files.
+	if err := removeEmptyDirs(s.dirOf(path), path != ""); err != nil {
+		return count, fmt.Errorf("delete pad %q: %w", path, err)
+	}
+	for ancestor := models.ParentPath(path); ancestor != ""; ancestor = models.ParentPath(ancestor) {
+		if err := s.toFlatForm(ancestor); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// CountSubtree returns the number of stored pads in the subtree rooted at
+// path, including path itself.
+func (s *FileStore) CountSubtree(path string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	err := s.walkPads(path, func(string, string) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("count subtree of %q: %w", path, err)
+	}
+	return count, nil
+}
+
+// GetSubtree returns the pads stored as files in the subtree rooted at
+// path, including path itself, sorted by path.
+func (s *FileStore) GetSubtree(path string) ([]*models.Pad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var paths []string
+	err := s.walkPads(path, func(padPath, file string) error {
+		paths = append(paths, padPath)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get subtree of %q: %w", path, err)
+	}
+	sort.Strings(paths)
+
+	pads := make([]*models.Pad, 0, len(paths))
+	for i, p := range paths {
+		// A pad present in both forms is walked twice.
+		if i > 0 && paths[i-1] == p {
+			continue
+		}
+		pad, err := s.getPad(p)
+		if err != nil {
+			return nil, err
+		}
+		pads = append(pads, pad)
+	}
+	return pads, nil
+}
+
+// GetChildren returns the direct children of a path that are stored as
+// files, sorted by path.
+func (s *FileStore) GetChildren(parentPath string) ([]models.ChildPad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	children := []models.ChildPad{}
+	entries, err := os.ReadDir(s.dirOf(parentPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return children, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get children of %q: %w", parentPath, err)
+	}
+
+	// A pad may be present in both forms after external edits; list it once.
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		name := entry.Name()
+		file := filepath.Join(s.dirOf(parentPath), name)
+		if entry.IsDir() {
+			file = filepath.Join(file, indexFile)
+		} else if name == indexFile || !strings.HasSuffix(name, ".md") {
+			continue
+		} else {
+			name = strings.TrimSuffix(name, ".md")
+		}
+
+		childPath := joinPath(parentPath, name)
+		if models.ValidatePath(childPath) != nil || seen[childPath] {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		seen[childPath] = true
+		children = append(children, models.ChildPad{Path: childPath, UpdatedAt: info.ModTime().Unix()})
+	}
+
+	sort.Slice(children, func(i, j int) bool { return children[i].Path < children[j].Path })
+	return children, nil
+}
+
+// PathExists checks if a file exists for the pad.
+func (s *FileStore) PathExists(path string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, _, err := s.findPad(path)
+	if err != nil {
+		return false, err
+	}
+	return file != "", nil
+}
+
+// dirOf returns the directory holding the pad's descendants.
+func (s *FileStore) dirOf(path string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path))
+}
+
+// flatFile returns the file of a pad without descendants.
+func (s *FileStore) flatFile(path string) string {
+	return s.dirOf(path) + ".md"
+}
+
+// findPad returns the file holding the pad, or "" if the pad is implicit.
+func (s *FileStore) findPad(path string) (string, fs.FileInfo, error) {
+	candidates := []string{filepath.Join(s.dirOf(path), indexFile)}
+	if hasFlatForm(path) {
+		candidates = append(candidates, s.flatFile(path))
+	}
+	for _, file := range candidates {
+		info, err := os.Stat(file)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+			continue
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("find pad %q: %w", path, err)
+		}
+		if info.Mode().IsRegular() {
+			return file, info, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// observe returns the pad's version, bumping it if the file changed since
+// it was last seen.
+func (s *FileStore) observe(path string, info fs.FileInfo) int64 {
+	v, ok := s.versions[path]
+	if ok && v.modTime.Equal(info.ModTime()) && v.size == info.Size() {
+		return v.version
+	}
+	if ok {
+		s.changed[path] = true
+	} else {
+		v.version = s.vacated[path]
+	}
+	v = fileVersion{version: v.version + 1, modTime: info.ModTime(), size: info.Size()}
+	s.versions[path] = v
+	return v.version
+}
+
+// forget drops the state of a pad whose file is gone, keeping its version
+// for a pad created later at the same path.
+func (s *FileStore) forget(path string) {
+	if v, ok := s.versions[path]; ok {
+		s.vacated[path] = v.version
+	}
+	delete(s.versions, path)
+	delete(s.changed, path)
+}
+
+// toDirForm moves a pad stored as a plain file into its directory.
+func (s *FileStore) toDirForm(path string) error {
+	flat := s.flatFile(path)
+	if !isFile(flat) {
+		return nil
+	}
+	if err := os.MkdirAll(s.dirOf(path), 0755); err != nil {
+		return fmt.Errorf("move pad %q into directory: %w", path, err)
+	}
+	if err := os.Rename(flat, filepath.Join(s.dirOf(path), indexFile)); err != nil {
+		return fmt.Errorf("move pad %q into directory: %w", path, err)
+	}
+	return nil
+}
+
+// toFlatForm moves a pad whose directory holds nothing but its own content
+// back to a plain file, and removes the directory of an implicit pad once
+// it is empty.
+func (s *FileStore) toFlatForm(path string) error {
+	dir := s.dirOf(path)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("tidy pad %q: %w", path, err)
+	}
+
+	switch {
+	case len(entries) == 0:
+		err = os.Remove(dir)
+	case len(entries) == 1 && entries[0].Name() == indexFile && hasFlatForm(path):
+		if err = os.Rename(filepath.Join(dir, indexFile), s.flatFile(path)); err == nil {
+			err = os.Remove(dir)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("tidy pad %q: %w", path, err)
+	}
+	return nil
+}
+
+// walkPads calls fn with every pad file in the subtree rooted at path.
+func (s *FileStore) walkPads(path string, fn func(padPath, file string) error) error {
+	if hasFlatForm(path) && isFile(s.flatFile(path)) {
+		if err := fn(path, s.flatFile(path)); err != nil {
+			return err
+		}
+	}
+	return s.walkDir(path, fn)
+}
+
+func (s *FileStore) walkDir(path string, fn func(padPath, file string) error) error {
+	dir := s.dirOf(path)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		file := filepath.Join(dir, name)
+		switch {
+		case name == indexFile && entry.Type().IsRegular():
+			err = fn(path, file)
+		case entry.IsDir():
+			if models.ValidatePath(joinPath(path, name)) == nil {
+				err = s.walkDir(joinPath(path, name), fn)
+			}
+		case strings.HasSuffix(name, ".md") && entry.Type().IsRegular():
+			name = strings.TrimSuffix(name, ".md")
+			if models.ValidatePath(joinPath(path, name)) == nil && name != "index" {
+				err = fn(joinPath(path, name), file)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEmptyDirs removes the empty directories below dir, and dir itself
+// if it ends up empty and removeSelf is set.
+func removeEmptyDirs(dir string, removeSelf bool) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	remaining := len(entries)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		sub := filepath.Join(dir, entry.Name())
+		if err := removeEmptyDirs(sub, true); err != nil {
+			return err
+		}
+		if !isDir(sub) {
+			remaining--
+		}
+	}
+	if removeSelf && remaining == 0 {
+		return os.Remove(dir)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to file and renames
+// it into place, so readers never see a partially written pad.
+func writeFileAtomic(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".pathpad-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// hasFlatForm reports whether the pad can be stored as a plain file. A pad
+// named index can't, as its file would be the parent's content.
+func hasFlatForm(path string) bool {
+	return path != "" && pathBase(path) != "index"
+}
+
+func isFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func isDir(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+// joinPath appends a segment to a pad path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "/" + name
+}
+
+// pathBase returns the last segment of a pad path.
+func pathBase(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
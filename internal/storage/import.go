@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// How ImportPads handles pads that already exist.
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	ImportRename    = "rename"
+)
+
+// ImportPads saves pads, which must lie in the subtree at root, in a single
+// transaction. Pads that already exist are left alone, overwritten or
+// imported under a free path with a numeric suffix, depending on onConflict.
+// A renamed pad takes its descendants in pads along, so a subtree stays
+// together. The root pad itself is skipped rather than renamed, since that
+// would write the import outside the subtree. With dryRun nothing is saved,
+// but the result still reports what would happen. Pads are saved by author.
+// Paths must be valid and unique. Results are in the order of pads.
+func (s *SQLiteStore) ImportPads(root string, pads []*models.Pad, onConflict string, dryRun bool, author string) ([]models.ImportedPad, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Import ancestors first, so that their renames are known by the time
+	// their descendants come up.
+	order := make([]int, len(pads))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return pads[order[a]].Path < pads[order[b]].Path })
+
+	now := time.Now().Unix()
+	renamed := map[string]string{}
+	results := make([]models.ImportedPad, len(pads))
+	for _, i := range order {
+		pad := pads[i]
+		result := models.ImportedPad{Path: renamedPath(pad.Path, renamed), Status: "created"}
+		if result.Path != pad.Path {
+			result.Status = "renamed"
+		}
+
+		exists, err := padExistsTx(tx, result.Path)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			switch onConflict {
+			case ImportSkip:
+				result.Status = "skipped"
+			case ImportRename:
+				if result.Path == root {
+					result.Status = "skipped"
+					break
+				}
+				result.Status = "renamed"
+				if result.Path, err = freePath(tx, result.Path); err != nil {
+					return nil, err
+				}
+				renamed[pad.Path] = result.Path
+			case ImportOverwrite:
+				result.Status = "overwritten"
+			default:
+				return nil, fmt.Errorf("unknown conflict mode %q", onConflict)
+			}
+		}
+
+		if result.Status != "skipped" {
+			if err := s.savePadTx(tx, result.Path, pad.Content, nil, now, author); err != nil {
+				return nil, err
+			}
+		}
+		results[i] = result
+	}
+
+	if dryRun {
+		return results, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit import: %w", err)
+	}
+	return results, nil
+}
+
+// renamedPath returns path with its nearest renamed ancestor, if any,
+// replaced by that ancestor's new path.
+func renamedPath(path string, renamed map[string]string) string {
+	for ancestor := models.ParentPath(path); ancestor != ""; ancestor = models.ParentPath(ancestor) {
+		if to, ok := renamed[ancestor]; ok {
+			return to + path[len(ancestor):]
+		}
+	}
+	return path
+}
+
+func padExistsTx(tx *sql.Tx, path string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM pads WHERE path = ?)`, path).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("path exists %q: %w", path, err)
+	}
+	return exists, nil
+}
+
+// freePath returns the first path of the form path-N that is neither in use
+// nor has descendants, so a renamed subtree doesn't mix with existing pads.
+func freePath(tx *sql.Tx, path string) (string, error) {
+	for n := 1; ; n++ {
+		candidate := path + "-" + strconv.Itoa(n)
+		if err := models.ValidatePath(candidate); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidDestination, err)
+		}
+		var used bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM pads WHERE `+subtreeWhere+`)`, subtreeArgs(candidate)...).Scan(&used)
+		if err != nil {
+			return "", fmt.Errorf("path exists %q: %w", candidate, err)
+		}
+		if !used {
+			return candidate, nil
+		}
+	}
+}
@@ -0,0 +1,119 @@
+//go:build sqlite_fts5
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"pathpad/internal/models"
+)
+
+func TestImportRenameKeepsSubtreeTogether(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	savePads(t, s, "docs", "docs/guide", "docs-1/keep")
+
+	// Descendants come before their ancestors, as they may in an archive.
+	pads := []*models.Pad{
+		{Path: "docs/guide/intro", Content: "intro"},
+		{Path: "docs", Content: "docs"},
+		{Path: "docs/guide", Content: "guide"},
+		{Path: "other", Content: "other"},
+	}
+	want := []models.ImportedPad{
+		{Path: "docs-2/guide/intro", Status: "renamed"},
+		{Path: "docs-2", Status: "renamed"},
+		{Path: "docs-2/guide", Status: "renamed"},
+		{Path: "other", Status: "created"},
+	}
+
+	results, err := s.ImportPads("", pads, ImportRename, true, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("dry run = %+v, want %+v", results, want)
+	}
+	if exists, _ := s.PathExists("docs-2"); exists {
+		t.Error("dry run saved pads")
+	}
+
+	results, err = s.ImportPads("", pads, ImportRename, false, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("import = %+v, want %+v", results, want)
+	}
+	for path, content := range map[string]string{
+		"docs-2/guide/intro": "intro",
+		"docs-2/guide":       "guide",
+		"docs/guide":         "content of docs/guide",
+		"docs-1/keep":        "content of docs-1/keep",
+	} {
+		if pad, err := s.GetPad(path); err != nil || pad.Content != content {
+			t.Errorf("%s = %q, %v; want %q", path, pad.Content, err, content)
+		}
+	}
+	if exists, _ := s.PathExists("docs/guide/intro"); exists {
+		t.Error("descendant of a renamed pad was imported under the old path")
+	}
+}
+
+func TestImportConflictModes(t *testing.T) {
+	pads := []*models.Pad{
+		{Path: "a/b", Content: "new b"},
+		{Path: "a", Content: "new a"},
+		{Path: "c", Content: "new c"},
+	}
+	tests := []struct {
+		mode string
+		want []models.ImportedPad
+		a    string
+	}{
+		{ImportSkip, []models.ImportedPad{{Path: "a/b", Status: "created"}, {Path: "a", Status: "skipped"}, {Path: "c", Status: "created"}}, "content of a"},
+		{ImportOverwrite, []models.ImportedPad{{Path: "a/b", Status: "created"}, {Path: "a", Status: "overwritten"}, {Path: "c", Status: "created"}}, "new a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s := newTestSQLiteStore(t)
+			savePads(t, s, "a")
+			results, err := s.ImportPads("", pads, tt.mode, false, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(results, tt.want) {
+				t.Errorf("results = %+v, want %+v", results, tt.want)
+			}
+			if pad, _ := s.GetPad("a"); pad.Content != tt.a {
+				t.Errorf("a = %q, want %q", pad.Content, tt.a)
+			}
+		})
+	}
+}
+
+func TestImportRenameKeepsRoot(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	savePads(t, s, "team", "team/plan")
+
+	pads := []*models.Pad{
+		{Path: "team", Content: "team"},
+		{Path: "team/plan", Content: "plan"},
+		{Path: "team/plan/q1", Content: "q1"},
+	}
+	want := []models.ImportedPad{
+		{Path: "team", Status: "skipped"},
+		{Path: "team/plan-1", Status: "renamed"},
+		{Path: "team/plan-1/q1", Status: "renamed"},
+	}
+	results, err := s.ImportPads("team", pads, ImportRename, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("import = %+v, want %+v", results, want)
+	}
+	if pad, _ := s.GetPad("team"); pad.Content != "content of team" {
+		t.Errorf("team = %q, want it unchanged", pad.Content)
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// MemoryStore keeps pads in memory. Everything is lost when the process
+// exits, which makes it suitable for tests and ephemeral deployments.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	pads map[string]models.Pad
+
+	// Versions of deleted pads, which pads created later at the same path
+	// continue from.
+	vacated map[string]int64
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{pads: make(map[string]models.Pad), vacated: make(map[string]int64)}
+}
+
+// Ping always succeeds.
+func (s *MemoryStore) Ping() error {
+	return nil
+}
+
+// Close is a no-op.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// GetPad retrieves a pad by path. Returns an implicit pad if it isn't stored.
+func (s *MemoryStore) GetPad(path string) (*models.Pad, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if pad, ok := s.pads[path]; ok {
+		return &pad, nil
+	}
+	return &models.Pad{Path: path, ParentPath: models.ParentPath(path)}, nil
+}
+
+// SavePad creates or updates a pad, bumping its version.
+func (s *MemoryStore) SavePad(path, content, author string) (*models.Pad, error) {
+	return s.savePad(path, content, nil, author)
+}
+
+// SavePadIfVersion saves a pad only if its current version equals
+// expectedVersion. Returns ErrVersionConflict otherwise.
+func (s *MemoryStore) SavePadIfVersion(path, content string, expectedVersion int64, author string) (*models.Pad, error) {
+	return s.savePad(path, content, &expectedVersion, author)
+}
+
+func (s *MemoryStore) savePad(path, content string, expectedVersion *int64, author string) (*models.Pad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pad, ok := s.pads[path]
+	if expectedVersion != nil && *expectedVersion != pad.Version {
+		return nil, ErrVersionConflict
+	}
+
+	now := time.Now().Unix()
+	if !ok {
+		pad = models.Pad{Path: path, ParentPath: models.ParentPath(path), Version: s.vacated[path], CreatedAt: now, CreatedBy: author}
+	}
+	pad.Content = content
+	pad.Version++
+	pad.UpdatedAt = now
+	pad.UpdatedBy = author
+	s.pads[path] = pad
+	return &pad, nil
+}
+
+// DeletePad deletes a pad and all its descendants. Returns the count of
+// deleted pads.
+func (s *MemoryStore) DeletePad(path string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for p, pad := range s.pads {
+		if inSubtree(p, path) {
+			s.vacated[p] = pad.Version
+			delete(s.pads, p)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CountSubtree returns the number of stored pads in the subtree rooted at
+// path, including path itself.
+func (s *MemoryStore) CountSubtree(path string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for p := range s.pads {
+		if inSubtree(p, path) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetSubtree returns the stored pads in the subtree rooted at path, including
+// path itself, sorted by path.
+func (s *MemoryStore) GetSubtree(path string) ([]*models.Pad, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pads := []*models.Pad{}
+	for p, pad := range s.pads {
+		if inSubtree(p, path) {
+			pad := pad
+			pads = append(pads, &pad)
+		}
+	}
+	sort.Slice(pads, func(i, j int) bool { return pads[i].Path < pads[j].Path })
+	return pads, nil
+}
+
+// GetChildren returns the direct children of a path, sorted by path.
+func (s *MemoryStore) GetChildren(parentPath string) ([]models.ChildPad, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	children := []models.ChildPad{}
+	for p, pad := range s.pads {
+		if p != parentPath && pad.ParentPath == parentPath {
+			children = append(children, models.ChildPad{Path: p, UpdatedAt: pad.UpdatedAt})
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Path < children[j].Path })
+	return children, nil
+}
+
+// PathExists checks if a pad is stored at path.
+func (s *MemoryStore) PathExists(path string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.pads[path]
+	return ok, nil
+}
+
+// inSubtree reports whether p is root or a descendant of root. Every path is
+// in the subtree of the root path.
+func inSubtree(p, root string) bool {
+	return root == "" || p == root || strings.HasPrefix(p, root+"/")
+}
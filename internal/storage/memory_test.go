@@ -0,0 +1,15 @@
+package storage
+
+import "testing"
+
+func TestMemoryVersionsSurviveDelete(t *testing.T) {
+	s := NewMemoryStore()
+	savePads(t, s, "notes", "notes")
+
+	if _, err := s.DeletePad(""); err != nil {
+		t.Fatal(err)
+	}
+	if pad, err := s.SavePadIfVersion("notes", "new", 0, "ada"); err != nil || pad.Version != 3 {
+		t.Errorf("recreate = %+v, %v, want version 3", pad, err)
+	}
+}
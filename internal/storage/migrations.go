@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when opening a database that was migrated by a
+// newer version of Pathpad than this one.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of Pathpad supports")
+
+// migration is one step of a database schema. Migrations are listed in
+// version order starting at 1, and each one runs in its own transaction
+// together with recording its version.
+type migration struct {
+	version     int
+	description string
+	sql         string
+}
+
+// AppliedMigration is a schema version recorded in a database.
+type AppliedMigration struct {
+	Version     int
+	Description string
+	// AppliedAt is zero for versions applied before timestamps were recorded.
+	AppliedAt int64
+}
+
+// migrator runs migrations against one kind of database.
+type migrator struct {
+	db         *sql.DB
+	migrations []migration
+
+	// begin starts a migration transaction, taking whatever lock keeps
+	// other processes from migrating at the same time.
+	begin func() (*sql.Tx, error)
+
+	// versioned reports whether the schema_version table exists.
+	versioned func() (bool, error)
+
+	// addColumns adds the description and applied_at columns to a
+	// schema_version table created before they existed.
+	addColumns func(tx *sql.Tx) error
+}
+
+// latest returns the newest schema version the migrations lead to.
+func (m *migrator) latest() int {
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// run applies all pending migrations and returns the resulting version. It
+// refuses to touch a database whose schema is newer than the migrations.
+func (m *migrator) run() (int, error) {
+	// Check the version before changing anything, even the schema_version
+	// table, which a newer Pathpad may have laid out differently.
+	versioned, err := m.versioned()
+	if err != nil {
+		return 0, fmt.Errorf("find schema_version table: %w", err)
+	}
+	version := 0
+	if versioned {
+		if version, err = schemaVersion(m.db); err != nil {
+			return 0, err
+		}
+	}
+	if version > m.latest() {
+		return version, fmt.Errorf("%w: database is at version %d, this binary supports up to %d", ErrSchemaTooNew, version, m.latest())
+	}
+
+	if err := m.prepare(); err != nil {
+		return 0, err
+	}
+
+	for _, mig := range m.migrations {
+		if mig.version <= version {
+			continue
+		}
+		applied, err := m.apply(mig)
+		if err != nil {
+			return version, fmt.Errorf("migration v%d: %w", mig.version, err)
+		}
+		if applied {
+			version = mig.version
+		}
+	}
+
+	// Another process may have migrated further while this one was waiting.
+	version, err = schemaVersion(m.db)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("[db] Schema at version %d\n", version)
+	return version, nil
+}
+
+// prepare creates the schema_version table, or brings an old one up to date.
+func (m *migrator) prepare() error {
+	tx, err := m.begin()
+	if err != nil {
+		return fmt.Errorf("begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER NOT NULL,
+			description TEXT,
+			applied_at BIGINT
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_version table: %w", err)
+	}
+	if err := m.addColumns(tx); err != nil {
+		return fmt.Errorf("update schema_version table: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit schema_version table: %w", err)
+	}
+	return nil
+}
+
+// apply runs one migration and records it. It reports false if another
+// process applied it first.
+func (m *migrator) apply(mig migration) (bool, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return false, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	version, err := schemaVersion(tx)
+	if err != nil {
+		return false, err
+	}
+	if version >= mig.version {
+		return false, nil
+	}
+
+	log.Printf("[db] Running migration v%d: %s", mig.version, mig.description)
+	if _, err := tx.Exec(mig.sql); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO schema_version (version, description, applied_at) VALUES ($1, $2, $3)`,
+		mig.version, mig.description, time.Now().Unix(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("record version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit: %w", err)
+	}
+	return true, nil
+}
+
+// history lists the applied schema versions, oldest first. Versions recorded
+// without a description get the one from the migration list.
+func (m *migrator) history() ([]AppliedMigration, error) {
+	rows, err := m.db.Query(`
+		SELECT version, COALESCE(description, ''), COALESCE(applied_at, 0)
+		FROM schema_version ORDER BY version ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list schema versions: %w", err)
+	}
+	defer rows.Close()
+
+	descriptions := map[int]string{}
+	for _, mig := range m.migrations {
+		descriptions[mig.version] = mig.description
+	}
+
+	applied := []AppliedMigration{}
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Description, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("scan schema version: %w", err)
+		}
+		if a.Description == "" {
+			a.Description = descriptions[a.Version]
+		}
+		applied = append(applied, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schema versions: %w", err)
+	}
+	return applied, nil
+}
+
+// schemaVersion returns the newest applied schema version, 0 for a new
+// database.
+func schemaVersion(db queryer) (int, error) {
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
@@ -0,0 +1,58 @@
+//go:build sqlite_fts5
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaTooNewLeftAlone(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "pathpad.db")
+
+	// A newer Pathpad that keeps schema_version without the columns this
+	// one adds.
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE schema_version (version INTEGER NOT NULL); INSERT INTO schema_version VALUES (999)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := NewSQLiteStore(dbPath); !errors.Is(err, ErrSchemaTooNew) {
+		if s != nil {
+			s.Close()
+		}
+		t.Fatalf("open newer database: %v, want ErrSchemaTooNew", err)
+	}
+	var columns, tables int
+	err = db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM pragma_table_info('schema_version')),
+			(SELECT COUNT(*) FROM sqlite_master WHERE type = 'table')
+	`).Scan(&columns, &tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns != 1 || tables != 1 {
+		t.Errorf("newer database changed: schema_version has %d columns, %d tables", columns, tables)
+	}
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	history, err := s.SchemaHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != len(sqliteMigrations) {
+		t.Fatalf("%d versions recorded, want %d", len(history), len(sqliteMigrations))
+	}
+	if version, err := s.migrator().run(); err != nil || version != len(sqliteMigrations) {
+		t.Errorf("migrate again = %d, %v", version, err)
+	}
+}
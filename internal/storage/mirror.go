@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"pathpad/internal/models"
+)
+
+// Mirror keeps a directory of Markdown files, laid out like the files
+// backend, in step with another store. Pathpad writes every change to the
+// mirror, and pads edited in the mirror are copied back into the store, so
+// any backend can be grepped, edited and committed to git like the files
+// backend.
+type Mirror struct {
+	// mu serializes syncing, so that a write always leaves the mirror with
+	// the store's latest state of a pad, whatever order requests finish in.
+	mu    sync.Mutex
+	store Store
+	files *FileStore
+}
+
+// NewMirror mirrors store to dir, creating the directory if needed. Pads in
+// dir that store doesn't have are removed, and pads that differ are
+// overwritten: on startup the store is authoritative.
+func NewMirror(store Store, dir string) (*Mirror, error) {
+	files, err := NewFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mirror{store: store, files: files}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.sync(""); err != nil {
+		return nil, fmt.Errorf("mirror pads to %q: %w", dir, err)
+	}
+	return m, nil
+}
+
+// SyncPad writes the current state of a pad to the mirror. A nil mirror
+// does nothing, so callers needn't check whether mirroring is enabled.
+// Errors are logged: the store has the change either way.
+func (m *Mirror) SyncPad(path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pad, err := m.store.GetPad(path)
+	if err == nil && pad.Version == 0 {
+		err = m.sync(path)
+	} else if err == nil {
+		err = m.write(pad)
+	}
+	if err != nil {
+		log.Printf("[files] Failed to mirror pad %q: %v", path, err)
+	}
+}
+
+// Sync writes the current state of a pad and its descendants to the mirror,
+// e.g. after they were deleted or moved. A nil mirror does nothing.
+func (m *Mirror) Sync(path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.sync(path); err != nil {
+		log.Printf("[files] Failed to mirror pads below %q: %v", path, err)
+	}
+}
+
+// sync makes the subtree at path in the mirror match the store. The caller
+// must hold m.mu.
+func (m *Mirror) sync(path string) error {
+	want, err := m.store.GetSubtree(path)
+	if err != nil {
+		return err
+	}
+	have, err := m.files.GetSubtree(path)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(want))
+	for _, pad := range want {
+		wanted[pad.Path] = true
+	}
+	// Deleting a pad from the mirror takes its descendants along; the ones
+	// still wanted are written again below.
+	for _, pad := range have {
+		if wanted[pad.Path] {
+			continue
+		}
+		if _, err := m.files.DeletePad(pad.Path); err != nil {
+			return err
+		}
+	}
+	for _, pad := range want {
+		if err := m.write(pad); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write saves pad to the mirror unless it already has that content. The
+// caller must hold m.mu.
+func (m *Mirror) write(pad *models.Pad) error {
+	current, err := m.files.GetPad(pad.Path)
+	if err != nil {
+		return err
+	}
+	if current.Version > 0 && current.Content == pad.Content {
+		return nil
+	}
+	_, err = m.files.SavePad(pad.Path, pad.Content, pad.UpdatedBy)
+	return err
+}
+
+// Watch copies pads created, changed or deleted in the mirror directory
+// into the store, then calls onChange with their paths, sorted. Call the
+// returned function to stop watching.
+func (m *Mirror) Watch(onChange func(paths []string)) (stop func() error, err error) {
+	return m.files.Watch(func(paths []string) {
+		changed := m.apply(paths)
+		if len(changed) > 0 {
+			sort.Strings(changed)
+			onChange(changed)
+		}
+	})
+}
+
+// apply copies the mirror's state of paths into the store and returns the
+// paths of the pads it changed there.
+func (m *Mirror) apply(paths []string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var changed []string
+	for _, path := range paths {
+		mirrored, err := m.files.GetPad(path)
+		if err != nil {
+			log.Printf("[files] Failed to read mirrored pad %q: %v", path, err)
+			continue
+		}
+		stored, err := m.store.GetPad(path)
+		if err != nil {
+			log.Printf("[files] Failed to read pad %q: %v", path, err)
+			continue
+		}
+
+		switch {
+		case mirrored.Version > 0:
+			if stored.Version > 0 && stored.Content == mirrored.Content {
+				continue
+			}
+			if _, err := m.store.SavePad(path, mirrored.Content, ""); err != nil {
+				log.Printf("[files] Failed to save mirrored pad %q: %v", path, err)
+				continue
+			}
+			changed = append(changed, path)
+
+		case stored.Version > 0:
+			// The store deletes descendants along with a pad. If the mirror
+			// still has some, empty the pad instead.
+			count, err := m.files.CountSubtree(path)
+			if err == nil && count > 0 {
+				_, err = m.store.SavePad(path, "", "")
+			} else if err == nil {
+				_, err = m.store.DeletePad(path)
+			}
+			if err != nil {
+				log.Printf("[files] Failed to delete mirrored pad %q: %v", path, err)
+				continue
+			}
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMirrorSync(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+	savePads(t, store, "", "a", "a/b")
+	if err := os.WriteFile(filepath.Join(dir, "stale.md"), []byte("gone"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a pad"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMirror(store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "a", "index.md")); got != "content of a" {
+		t.Errorf("a/index.md = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "a", "b.md")); got != "content of a/b" {
+		t.Errorf("a/b.md = %q", got)
+	}
+	if isFile(filepath.Join(dir, "stale.md")) {
+		t.Error("pad missing from the store is still mirrored")
+	}
+	if !isFile(filepath.Join(dir, "notes.txt")) {
+		t.Error("file that isn't a pad was removed")
+	}
+
+	if _, err := store.SavePad("a/b", "edited", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	m.SyncPad("a/b")
+	if got := readFile(t, filepath.Join(dir, "a", "b.md")); got != "edited" {
+		t.Errorf("a/b.md after save = %q", got)
+	}
+
+	if _, err := store.DeletePad("a"); err != nil {
+		t.Fatal(err)
+	}
+	m.Sync("a")
+	if isDir(filepath.Join(dir, "a")) || isFile(filepath.Join(dir, "a.md")) {
+		t.Error("deleted subtree is still mirrored")
+	}
+	if !isFile(filepath.Join(dir, "index.md")) {
+		t.Error("root pad was removed along with a")
+	}
+
+	// A nil mirror ignores changes.
+	var none *Mirror
+	none.SyncPad("a")
+	none.Sync("")
+}
+
+func TestMirrorWatch(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+	savePads(t, store, "a", "a/b", "c")
+
+	m, err := NewMirror(store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan []string, 10)
+	stop, err := m.Watch(func(paths []string) { changes <- paths })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	wait := func(want ...string) {
+		t.Helper()
+		select {
+		case got := <-changes:
+			if !slices.Equal(got, want) {
+				t.Fatalf("changed %v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change reported, want %v", want)
+		}
+	}
+
+	// Writes through the mirror aren't reported back.
+	if _, err := store.SavePad("c", "from Pathpad", ""); err != nil {
+		t.Fatal(err)
+	}
+	m.SyncPad("c")
+
+	if err := os.WriteFile(filepath.Join(dir, "c.md"), []byte("from an editor"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wait("c")
+	if pad, _ := store.GetPad("c"); pad.Content != "from an editor" {
+		t.Errorf("c in the store = %q after editing its file", pad.Content)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "d.md"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wait("d")
+	if pad, _ := store.GetPad("d"); pad.Content != "new" {
+		t.Errorf("d in the store = %q after creating its file", pad.Content)
+	}
+
+	// Removing a pad with descendants left in the mirror empties it.
+	if err := os.Remove(filepath.Join(dir, "a", "index.md")); err != nil {
+		t.Fatal(err)
+	}
+	wait("a")
+	if pad, _ := store.GetPad("a"); pad.Version == 0 || pad.Content != "" {
+		t.Errorf("a in the store = %+v, want an empty pad", pad)
+	}
+	if pad, _ := store.GetPad("a/b"); pad.Content != "content of a/b" {
+		t.Errorf("a/b in the store = %q", pad.Content)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "d.md")); err != nil {
+		t.Fatal(err)
+	}
+	wait("d")
+	if pad, _ := store.GetPad("d"); pad.Version != 0 {
+		t.Errorf("d still in the store after removing its file: %+v", pad)
+	}
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// subtreeWhere matches a pad and all its descendants. It takes the pad path
+// three times (see subtreeArgs). Unlike LIKE, it has no wildcard characters
+// to trip over, so "a_b" never matches "axb/c".
+const subtreeWhere = `(path = ? OR substr(path, 1, ?) = ?)`
+
+// subtreeArgs returns the arguments for subtreeWhere.
+func subtreeArgs(path string) []interface{} {
+	return []interface{}{path, len(path) + 1, path + "/"}
+}
+
+// subtreeFilter returns a WHERE condition and its arguments matching the pad
+// at path and all its descendants. The root path matches every pad.
+func subtreeFilter(path string) (string, []interface{}) {
+	if path == "" {
+		return "1 = 1", nil
+	}
+	return subtreeWhere, subtreeArgs(path)
+}
+
+// subtreePaths returns the paths of all stored pads in the subtree rooted at
+// path, including path itself.
+func subtreePaths(tx *sql.Tx, path string) ([]string, error) {
+	rows, err := tx.Query(`SELECT path FROM pads WHERE `+subtreeWhere+` ORDER BY path`, subtreeArgs(path)...)
+	if err != nil {
+		return nil, fmt.Errorf("list subtree of %q: %w", path, err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("scan subtree path: %w", err)
+		}
+		paths = append(paths, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate subtree: %w", err)
+	}
+	return paths, nil
+}
+
+// rebasePaths maps subtree paths from src to dst and validates the results.
+// Returns ErrInvalidDestination if any new path would be invalid, e.g. too
+// deep or too long.
+func rebasePaths(paths []string, src, dst string) (map[string]string, error) {
+	mapped := make(map[string]string, len(paths))
+	for _, p := range paths {
+		newPath := dst + p[len(src):]
+		if err := models.ValidatePath(newPath); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDestination, newPath, err)
+		}
+		mapped[p] = newPath
+	}
+	return mapped, nil
+}
+
+// MovePad moves a pad and all its descendants from src to dst, along with
+// their revision history, in one transaction. Returns the number of moved
+// pads. Neither path may be root, and dst must not lie inside src. dst may
+// be an ancestor of src if src's subtree is all it holds.
+func (s *SQLiteStore) MovePad(src, dst string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin move pad %q: %w", src, err)
+	}
+	defer tx.Rollback()
+
+	paths, err := subtreePaths(tx, src)
+	if err != nil {
+		return 0, err
+	}
+	if len(paths) == 0 {
+		return 0, ErrPadNotFound
+	}
+	if _, err := rebasePaths(paths, src, dst); err != nil {
+		return 0, err
+	}
+
+	// dst may be an implicit ancestor of src, whose subtree then holds src's.
+	// Pads leaving the destination don't count as in its way.
+	outsideSrc := subtreeWhere + ` AND NOT ` + subtreeWhere
+	outsideSrcArgs := append(subtreeArgs(dst), subtreeArgs(src)...)
+
+	var existing int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM pads WHERE `+outsideSrc, outsideSrcArgs...).Scan(&existing)
+	if err != nil {
+		return 0, fmt.Errorf("check destination %q: %w", dst, err)
+	}
+	if existing > 0 {
+		return 0, ErrDestinationExists
+	}
+
+	if err := vacatePads(tx, subtreeWhere, subtreeArgs(src)); err != nil {
+		return 0, err
+	}
+
+	// Moving a pad into its implicit ancestor shortens paths onto others
+	// still waiting to move, e.g. a/b/b onto a/b. Set the subtree aside under
+	// a prefix no valid path has first.
+	from := src
+	if strings.HasPrefix(src, dst+"/") {
+		from = "\x01" + src
+		for _, table := range []string{"pads", "pad_revisions"} {
+			if _, err := tx.Exec(`UPDATE `+table+` SET path = char(1) || path WHERE `+subtreeWhere, subtreeArgs(src)...); err != nil {
+				return 0, fmt.Errorf("move pad %q to %q: %w", src, dst, err)
+			}
+		}
+	}
+
+	// Rewrite the src prefix of every path. The moved pad's own parent is the
+	// destination's parent; descendants keep their position below it. Their
+	// versions stay above those of pads that were at their new paths before.
+	args := append([]interface{}{dst, len(from) + 1, from, models.ParentPath(dst), dst, len(src) + 1, dst, len(from) + 1}, subtreeArgs(from)...)
+	result, err := tx.Exec(`
+		UPDATE pads SET
+			path = ? || substr(path, ?),
+			parent_path = CASE WHEN path = ? THEN ? ELSE ? || substr(parent_path, ?) END,
+			version = MAX(version, COALESCE((
+				SELECT vacated_paths.version + 1 FROM vacated_paths WHERE vacated_paths.path = ? || substr(pads.path, ?)
+			), 0))
+		WHERE `+subtreeWhere, args...)
+	if err != nil {
+		return 0, fmt.Errorf("move pad %q to %q: %w", src, dst, err)
+	}
+
+	// Revisions left behind by an earlier pad at the destination would
+	// collide with the moved history.
+	if _, err := tx.Exec(`DELETE FROM pad_revisions WHERE `+outsideSrc, outsideSrcArgs...); err != nil {
+		return 0, fmt.Errorf("clear destination revisions %q: %w", dst, err)
+	}
+	args = append([]interface{}{dst, len(from) + 1}, subtreeArgs(from)...)
+	if _, err := tx.Exec(`UPDATE pad_revisions SET path = ? || substr(path, ?) WHERE `+subtreeWhere, args...); err != nil {
+		return 0, fmt.Errorf("move revisions %q to %q: %w", src, dst, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit move pad %q: %w", src, err)
+	}
+	return count, nil
+}
+
+// CopyPad deep-copies a pad and all its descendants from src to dst in one
+// transaction. Copies are saved like regular edits by author: they get a new
+// version and revision, while the source history stays with the source. If a destination
+// pad already exists, the copy fails with ErrDestinationExists unless
+// overwrite is set. Pads already below dst that have no counterpart in src
+// are left alone. Returns the copied pads.
+func (s *SQLiteStore) CopyPad(src, dst string, overwrite bool, author string) ([]*models.Pad, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin copy pad %q: %w", src, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT path, content FROM pads WHERE `+subtreeWhere+` ORDER BY path`, subtreeArgs(src)...)
+	if err != nil {
+		return nil, fmt.Errorf("read subtree of %q: %w", src, err)
+	}
+	contents := make(map[string]string)
+	var paths []string
+	for rows.Next() {
+		var p, content string
+		if err := rows.Scan(&p, &content); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan subtree pad: %w", err)
+		}
+		paths = append(paths, p)
+		contents[p] = content
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate subtree: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, ErrPadNotFound
+	}
+
+	mapped, err := rebasePaths(paths, src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if !overwrite {
+		for _, p := range paths {
+			var exists int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM pads WHERE path = ?`, mapped[p]).Scan(&exists); err != nil {
+				return nil, fmt.Errorf("check destination %q: %w", mapped[p], err)
+			}
+			if exists > 0 {
+				return nil, fmt.Errorf("%w: %s", ErrDestinationExists, mapped[p])
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	for _, p := range paths {
+		if err := s.savePadTx(tx, mapped[p], contents[p], nil, now, author); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit copy pad %q: %w", src, err)
+	}
+
+	copied := make([]*models.Pad, 0, len(paths))
+	for _, p := range paths {
+		pad, err := s.GetPad(mapped[p])
+		if err != nil {
+			return nil, err
+		}
+		copied = append(copied, pad)
+	}
+	return copied, nil
+}
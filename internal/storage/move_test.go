@@ -0,0 +1,73 @@
+//go:build sqlite_fts5
+
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"pathpad/internal/models"
+)
+
+// storedPaths returns the paths of all stored pads, sorted.
+func storedPaths(t *testing.T, s Store) []string {
+	t.Helper()
+	pads, err := s.GetSubtree("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, pad := range pads {
+		paths = append(paths, pad.Path)
+	}
+	return paths
+}
+
+func TestMoveIntoImplicitParent(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	// a/b/b is saved before a/b, whose new path it takes.
+	savePads(t, s, "a/b/b", "a/b/c", "a/b/c", "a/b")
+
+	count, err := s.MovePad("a/b", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("moved %d pads, want 3", count)
+	}
+	if got, want := storedPaths(t, s), []string{"a", "a/b", "a/c"}; !slices.Equal(got, want) {
+		t.Errorf("pads after move = %v, want %v", got, want)
+	}
+	for path, content := range map[string]string{
+		"a":   "content of a/b",
+		"a/b": "content of a/b/b",
+		"a/c": "content of a/b/c",
+	} {
+		if pad, err := s.GetPad(path); err != nil || pad.Content != content || pad.ParentPath != models.ParentPath(path) {
+			t.Errorf("%s = %+v, %v; want content %q", path, pad, err, content)
+		}
+	}
+	revisions, err := s.ListRevisions("a/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 {
+		t.Errorf("a/c has %d revisions, want the 2 it had as a/b/c", len(revisions))
+	}
+	checkIndex(t, s)
+}
+
+func TestMoveOntoExistingPads(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	savePads(t, s, "a/b", "a/c", "x", "y/z")
+
+	for _, tt := range []struct{ src, dst string }{
+		{"a/b", "a"}, // a has a descendant besides a/b
+		{"x", "y"},   // y is implicit but has a descendant
+	} {
+		if _, err := s.MovePad(tt.src, tt.dst); !errors.Is(err, ErrDestinationExists) {
+			t.Errorf("MovePad(%s, %s) = %v, want ErrDestinationExists", tt.src, tt.dst, err)
+		}
+	}
+}
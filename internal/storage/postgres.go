@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"pathpad/internal/models"
+)
+
+// postgresMigrationLock is the advisory lock key taken while migrating, so
+// replicas starting at the same time don't run migrations concurrently.
+const postgresMigrationLock = 0x70617468706164 // "pathpad"
+
+// postgresSubtreeWhere matches the pad at $1 and its descendants, given
+// subtreeArgs.
+const postgresSubtreeWhere = `(path = $1 OR substr(path, 1, $2) = $3)`
+
+// PostgresStore provides persistent storage using PostgreSQL. Unlike SQLite
+// it can be shared by several Pathpad instances.
+type PostgresStore struct {
+	db  *sql.DB
+	dsn string // for listening to notifications
+}
+
+// NewPostgresStore connects to the PostgreSQL database at dsn and runs
+// migrations.
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	// Verify the connection works.
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	store := &PostgresStore{db: db, dsn: dsn}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate database: %w", err)
+	}
+
+	return store, nil
+}
+
+// postgresMigrations is the PostgreSQL schema, oldest change first. Append
+// new migrations to the end; never edit one that has been released.
+var postgresMigrations = []migration{
+	{1, "create pads table", `
+		CREATE TABLE IF NOT EXISTS pads (
+			path TEXT PRIMARY KEY,
+			content TEXT NOT NULL DEFAULT '',
+			parent_path TEXT NOT NULL DEFAULT '',
+			version BIGINT NOT NULL DEFAULT 1,
+			updated_at BIGINT NOT NULL,
+			created_at BIGINT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_parent_path ON pads(parent_path);
+		CREATE INDEX IF NOT EXISTS idx_updated_at ON pads(updated_at);
+	`},
+	{2, "add author columns", `
+		ALTER TABLE pads ADD COLUMN IF NOT EXISTS created_by TEXT NOT NULL DEFAULT '';
+		ALTER TABLE pads ADD COLUMN IF NOT EXISTS updated_by TEXT NOT NULL DEFAULT '';
+	`},
+	{3, "create access control tables", `
+		CREATE TABLE IF NOT EXISTS access_rules (
+			prefix TEXT PRIMARY KEY,
+			mode TEXT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS access_tokens (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL,
+			access TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			rate_limit INTEGER NOT NULL DEFAULT 0,
+			created_at BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS pad_locks (
+			prefix TEXT PRIMARY KEY,
+			password_hash TEXT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+	`},
+	{4, "create vacated_paths table", `
+		CREATE TABLE IF NOT EXISTS vacated_paths (
+			path TEXT PRIMARY KEY,
+			version BIGINT NOT NULL
+		);
+	`},
+}
+
+// migrator returns the migrator for the PostgreSQL schema. Every migration
+// transaction takes an advisory lock first.
+func (s *PostgresStore) migrator() *migrator {
+	return &migrator{
+		db:         s.db,
+		migrations: postgresMigrations,
+		begin: func() (*sql.Tx, error) {
+			tx, err := s.db.Begin()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresMigrationLock); err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("lock for migration: %w", err)
+			}
+			return tx, nil
+		},
+		versioned: func() (bool, error) {
+			var exists bool
+			err := s.db.QueryRow(`SELECT to_regclass('schema_version') IS NOT NULL`).Scan(&exists)
+			return exists, err
+		},
+		addColumns: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				ALTER TABLE schema_version ADD COLUMN IF NOT EXISTS description TEXT;
+				ALTER TABLE schema_version ADD COLUMN IF NOT EXISTS applied_at BIGINT;
+			`)
+			return err
+		},
+	}
+}
+
+// migrate runs pending schema migrations.
+func (s *PostgresStore) migrate() error {
+	_, err := s.migrator().run()
+	return err
+}
+
+// SchemaHistory lists the schema versions applied to the database, oldest
+// first.
+func (s *PostgresStore) SchemaHistory() ([]AppliedMigration, error) {
+	return s.migrator().history()
+}
+
+// Ping checks database connectivity.
+func (s *PostgresStore) Ping() error {
+	return s.db.Ping()
+}
+
+// Close closes the database connection pool.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// GetPad retrieves a pad by path. Returns an empty pad (with zero timestamps
+// and version) if the pad doesn't exist in the database (implicit pad).
+func (s *PostgresStore) GetPad(path string) (*models.Pad, error) {
+	pad := &models.Pad{Path: path}
+	err := s.db.QueryRow(
+		`SELECT content, parent_path, version, updated_at, created_at, updated_by, created_by FROM pads WHERE path = $1`,
+		path,
+	).Scan(&pad.Content, &pad.ParentPath, &pad.Version, &pad.UpdatedAt, &pad.CreatedAt, &pad.UpdatedBy, &pad.CreatedBy)
+
+	if err == sql.ErrNoRows {
+		pad.ParentPath = models.ParentPath(path)
+		return pad, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pad %q: %w", path, err)
+	}
+	return pad, nil
+}
+
+// postgresFirstVersion is the version of a pad created at $1: one more than
+// that of the last pad deleted there, if any.
+const postgresFirstVersion = `(SELECT COALESCE(MAX(version), 0) + 1 FROM vacated_paths WHERE path = $1)`
+
+// SavePad upserts a pad's content, bumping its version. Returns the saved pad.
+func (s *PostgresStore) SavePad(path, content, author string) (*models.Pad, error) {
+	return s.scanSaved(path, s.db.QueryRow(`
+		INSERT INTO pads (path, content, parent_path, version, updated_at, created_at, updated_by, created_by)
+		VALUES ($1, $2, $3, `+postgresFirstVersion+`, $4, $4, $5, $5)
+		ON CONFLICT (path) DO UPDATE SET
+			content = EXCLUDED.content,
+			version = pads.version + 1,
+			updated_at = EXCLUDED.updated_at,
+			updated_by = EXCLUDED.updated_by
+		RETURNING content, parent_path, version, updated_at, created_at, updated_by, created_by
+	`, path, content, models.ParentPath(path), time.Now().Unix(), author))
+}
+
+// SavePadIfVersion saves a pad only if its current version equals
+// expectedVersion (0 for a pad that doesn't exist yet). Returns
+// ErrVersionConflict otherwise. The check and the write are a single
+// statement, so concurrent saves from other instances can't slip in between.
+func (s *PostgresStore) SavePadIfVersion(path, content string, expectedVersion int64, author string) (*models.Pad, error) {
+	now := time.Now().Unix()
+	if expectedVersion == 0 {
+		return s.scanSaved(path, s.db.QueryRow(`
+			INSERT INTO pads (path, content, parent_path, version, updated_at, created_at, updated_by, created_by)
+			VALUES ($1, $2, $3, `+postgresFirstVersion+`, $4, $4, $5, $5)
+			ON CONFLICT (path) DO NOTHING
+			RETURNING content, parent_path, version, updated_at, created_at, updated_by, created_by
+		`, path, content, models.ParentPath(path), now, author))
+	}
+	return s.scanSaved(path, s.db.QueryRow(`
+		UPDATE pads SET content = $2, version = version + 1, updated_at = $3, updated_by = $5
+		WHERE path = $1 AND version = $4
+		RETURNING content, parent_path, version, updated_at, created_at, updated_by, created_by
+	`, path, content, now, expectedVersion, author))
+}
+
+// scanSaved reads the pad returned by a save. No row means the save's
+// version precondition didn't hold.
+func (s *PostgresStore) scanSaved(path string, row *sql.Row) (*models.Pad, error) {
+	pad := &models.Pad{Path: path}
+	err := row.Scan(&pad.Content, &pad.ParentPath, &pad.Version, &pad.UpdatedAt, &pad.CreatedAt, &pad.UpdatedBy, &pad.CreatedBy)
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("save pad %q: %w", path, err)
+	}
+	return pad, nil
+}
+
+// DeletePad deletes a pad and all its descendants. Returns the count of
+// deleted pads. Their versions are kept in vacated_paths, so that a client
+// still holding one can't save over a pad created later at the same path.
+func (s *PostgresStore) DeletePad(path string) (int64, error) {
+	where, args := "TRUE", []interface{}(nil)
+	if path != "" {
+		where, args = postgresSubtreeWhere, subtreeArgs(path)
+	}
+	result, err := s.db.Exec(`
+		WITH deleted AS (DELETE FROM pads WHERE `+where+` RETURNING path, version)
+		INSERT INTO vacated_paths (path, version) SELECT path, version FROM deleted
+		ON CONFLICT (path) DO UPDATE SET version = GREATEST(vacated_paths.version, EXCLUDED.version)
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("delete pad %q: %w", path, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return count, nil
+}
+
+// CountSubtree returns the number of stored pads in the subtree rooted at
+// path, including path itself.
+func (s *PostgresStore) CountSubtree(path string) (int64, error) {
+	var count int64
+	var err error
+	if path == "" {
+		err = s.db.QueryRow(`SELECT COUNT(*) FROM pads`).Scan(&count)
+	} else {
+		err = s.db.QueryRow(`SELECT COUNT(*) FROM pads WHERE `+postgresSubtreeWhere, subtreeArgs(path)...).Scan(&count)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("count subtree of %q: %w", path, err)
+	}
+	return count, nil
+}
+
+// GetSubtree returns the stored pads in the subtree rooted at path, including
+// path itself, sorted by path.
+func (s *PostgresStore) GetSubtree(path string) ([]*models.Pad, error) {
+	query := `SELECT path, content, parent_path, version, updated_at, created_at, updated_by, created_by FROM pads`
+	var args []interface{}
+	if path != "" {
+		query += ` WHERE ` + postgresSubtreeWhere
+		args = subtreeArgs(path)
+	}
+	rows, err := s.db.Query(query+` ORDER BY path COLLATE "C" ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get subtree of %q: %w", path, err)
+	}
+	defer rows.Close()
+
+	pads := []*models.Pad{}
+	for rows.Next() {
+		pad := &models.Pad{}
+		if err := rows.Scan(&pad.Path, &pad.Content, &pad.ParentPath, &pad.Version, &pad.UpdatedAt, &pad.CreatedAt, &pad.UpdatedBy, &pad.CreatedBy); err != nil {
+			return nil, fmt.Errorf("scan pad: %w", err)
+		}
+		pads = append(pads, pad)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate subtree: %w", err)
+	}
+	return pads, nil
+}
+
+// GetChildren returns the direct children of a path, sorted by path.
+func (s *PostgresStore) GetChildren(parentPath string) ([]models.ChildPad, error) {
+	rows, err := s.db.Query(
+		`SELECT path, updated_at FROM pads WHERE parent_path = $1 AND path != $1 ORDER BY path COLLATE "C" ASC`,
+		parentPath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get children of %q: %w", parentPath, err)
+	}
+	defer rows.Close()
+
+	children := []models.ChildPad{}
+	for rows.Next() {
+		var child models.ChildPad
+		if err := rows.Scan(&child.Path, &child.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan child: %w", err)
+		}
+		children = append(children, child)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate children: %w", err)
+	}
+	return children, nil
+}
+
+// PathExists checks if a pad with content exists in the database.
+func (s *PostgresStore) PathExists(path string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pads WHERE path = $1)`, path).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("path exists %q: %w", path, err)
+	}
+	return exists, nil
+}
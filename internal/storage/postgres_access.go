@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"pathpad/internal/models"
+)
+
+// accessChannel is the notification channel announcing changes to the
+// access control tables, so every replica reloads them.
+const accessChannel = "pathpad_access"
+
+// notifyAccess tells every replica that the access control state changed.
+func (s *PostgresStore) notifyAccess() error {
+	if _, err := s.db.Exec(`SELECT pg_notify($1, '')`, accessChannel); err != nil {
+		return fmt.Errorf("notify access change: %w", err)
+	}
+	return nil
+}
+
+// WatchAccess calls onChange when any replica changes the access control
+// state, and after reconnecting to the database, when notifications may
+// have been missed.
+func (s *PostgresStore) WatchAccess(onChange func()) (stop func() error, err error) {
+	listener := pq.NewListener(s.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("[db] Access change listener: %v", err)
+		}
+	})
+	if err := listener.Listen(accessChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("listen for access changes: %w", err)
+	}
+
+	go func() {
+		// The channel is closed by listener.Close. A nil notification
+		// follows a reconnect.
+		for range listener.Notify {
+			onChange()
+		}
+	}()
+	return listener.Close, nil
+}
+
+// ListAccessRules returns all access rules, sorted by prefix.
+func (s *PostgresStore) ListAccessRules() ([]models.AccessRule, error) {
+	rows, err := s.db.Query(`SELECT prefix, mode, updated_at FROM access_rules ORDER BY prefix ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list access rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.AccessRule{}
+	for rows.Next() {
+		var rule models.AccessRule
+		if err := rows.Scan(&rule.Prefix, &rule.Mode, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan access rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate access rules: %w", err)
+	}
+	return rules, nil
+}
+
+// SetAccessRule creates or replaces the rule for a prefix.
+func (s *PostgresStore) SetAccessRule(prefix, mode string) (*models.AccessRule, error) {
+	rule := &models.AccessRule{Prefix: prefix, Mode: mode, UpdatedAt: time.Now().Unix()}
+	_, err := s.db.Exec(`
+		INSERT INTO access_rules (prefix, mode, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (prefix) DO UPDATE SET mode = excluded.mode, updated_at = excluded.updated_at
+	`, rule.Prefix, rule.Mode, rule.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("set access rule %q: %w", prefix, err)
+	}
+	return rule, s.notifyAccess()
+}
+
+// DeleteAccessRule removes the rule for a prefix. Returns ErrRuleNotFound if
+// there is none.
+func (s *PostgresStore) DeleteAccessRule(prefix string) error {
+	result, err := s.db.Exec(`DELETE FROM access_rules WHERE prefix = $1`, prefix)
+	if err != nil {
+		return fmt.Errorf("delete access rule %q: %w", prefix, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrRuleNotFound
+	}
+	return s.notifyAccess()
+}
+
+// CreateAccessToken stores a new token under the hash of its secret and sets
+// its ID and creation time.
+func (s *PostgresStore) CreateAccessToken(token *models.AccessToken, hash string) error {
+	token.CreatedAt = time.Now().Unix()
+	err := s.db.QueryRow(`
+		INSERT INTO access_tokens (name, token_hash, prefix, access, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+	`, token.Name, hash, token.Prefix, token.Access, token.CreatedAt, token.ExpiresAt).Scan(&token.ID)
+	if err != nil {
+		return fmt.Errorf("create access token: %w", err)
+	}
+	return nil
+}
+
+// ListAccessTokens returns all tokens, oldest first, without their secrets.
+func (s *PostgresStore) ListAccessTokens() ([]models.AccessToken, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, prefix, access, created_at, expires_at
+		FROM access_tokens ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.AccessToken{}
+	for rows.Next() {
+		var t models.AccessToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.Access, &t.CreatedAt, &t.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan access token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate access tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// LookupAccessToken finds the unexpired token with the given hash. Returns
+// nil if there is none.
+func (s *PostgresStore) LookupAccessToken(hash string) (*models.AccessToken, error) {
+	var t models.AccessToken
+	err := s.db.QueryRow(`
+		SELECT id, name, prefix, access, created_at, expires_at
+		FROM access_tokens WHERE token_hash = $1 AND (expires_at = 0 OR expires_at > $2)
+	`, hash, time.Now().Unix()).Scan(&t.ID, &t.Name, &t.Prefix, &t.Access, &t.CreatedAt, &t.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("look up access token: %w", err)
+	}
+	return &t, nil
+}
+
+// DeleteAccessToken revokes a token. Returns ErrTokenNotFound if it doesn't
+// exist.
+func (s *PostgresStore) DeleteAccessToken(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM access_tokens WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete access token %d: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key under the hash of its secret and sets
+// its ID and creation time.
+func (s *PostgresStore) CreateAPIKey(key *models.APIKey, hash string) error {
+	key.CreatedAt = time.Now().Unix()
+	err := s.db.QueryRow(`
+		INSERT INTO api_keys (name, key_hash, prefix, scopes, rate_limit, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+	`, key.Name, hash, key.Prefix, strings.Join(key.Scopes, ","), key.RateLimit, key.CreatedAt, key.ExpiresAt).Scan(&key.ID)
+	if err != nil {
+		return fmt.Errorf("create API key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys returns all API keys, oldest first, without their secrets.
+func (s *PostgresStore) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, prefix, scopes, rate_limit, created_at, expires_at
+		FROM api_keys ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var scopes string
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.RateLimit, &k.CreatedAt, &k.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan API key: %w", err)
+		}
+		k.Scopes = splitScopes(scopes)
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// LookupAPIKey finds the unexpired API key with the given hash. Returns nil
+// if there is none.
+func (s *PostgresStore) LookupAPIKey(hash string) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	err := s.db.QueryRow(`
+		SELECT id, name, prefix, scopes, rate_limit, created_at, expires_at
+		FROM api_keys WHERE key_hash = $1 AND (expires_at = 0 OR expires_at > $2)
+	`, hash, time.Now().Unix()).Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.RateLimit, &k.CreatedAt, &k.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("look up API key: %w", err)
+	}
+	k.Scopes = splitScopes(scopes)
+	return &k, nil
+}
+
+// DeleteAPIKey revokes an API key. Returns ErrAPIKeyNotFound if it doesn't
+// exist.
+func (s *PostgresStore) DeleteAPIKey(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete API key %d: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ListPadLocks returns all password locks, including their password hashes,
+// sorted by prefix.
+func (s *PostgresStore) ListPadLocks() ([]models.PadLock, error) {
+	rows, err := s.db.Query(`SELECT prefix, password_hash, updated_at FROM pad_locks ORDER BY prefix ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list pad locks: %w", err)
+	}
+	defer rows.Close()
+
+	locks := []models.PadLock{}
+	for rows.Next() {
+		var lock models.PadLock
+		if err := rows.Scan(&lock.Prefix, &lock.Hash, &lock.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan pad lock: %w", err)
+		}
+		locks = append(locks, lock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pad locks: %w", err)
+	}
+	return locks, nil
+}
+
+// SetPadLock sets or replaces the password hash protecting a prefix.
+func (s *PostgresStore) SetPadLock(prefix, hash string) (*models.PadLock, error) {
+	lock := &models.PadLock{Prefix: prefix, Hash: hash, UpdatedAt: time.Now().Unix()}
+	_, err := s.db.Exec(`
+		INSERT INTO pad_locks (prefix, password_hash, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (prefix) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at
+	`, lock.Prefix, lock.Hash, lock.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("set pad lock %q: %w", prefix, err)
+	}
+	return lock, s.notifyAccess()
+}
+
+// DeletePadLock removes the password from a prefix. Returns ErrLockNotFound
+// if it has none.
+func (s *PostgresStore) DeletePadLock(prefix string) error {
+	result, err := s.db.Exec(`DELETE FROM pad_locks WHERE prefix = $1`, prefix)
+	if err != nil {
+		return fmt.Errorf("delete pad lock %q: %w", prefix, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return ErrLockNotFound
+	}
+	return s.notifyAccess()
+}
+
+// Setting returns a stored setting, or "" if it isn't set.
+func (s *PostgresStore) Setting(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get setting %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSetting stores a setting. Settings hold the keys share links and
+// unlock cookies are signed with, so the other replicas reload them.
+func (s *PostgresStore) SetSetting(key, value string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO settings (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	if err != nil {
+		return fmt.Errorf("set setting %q: %w", key, err)
+	}
+	return s.notifyAccess()
+}
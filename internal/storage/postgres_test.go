@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// newTestPostgresStore connects to the database in PATHPAD_TEST_POSTGRES_DSN,
+// skipping the test if it is unset. The database is wiped first, so it must
+// be a scratch database.
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	dsn := os.Getenv("PATHPAD_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("PATHPAD_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("reset database: %v", err)
+	}
+
+	s, err := NewPostgresStore(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func savePads(t *testing.T, s Store, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		if _, err := s.SavePad(path, "content of "+path, "ada"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPostgresImplicitPad(t *testing.T) {
+	s := newTestPostgresStore(t)
+
+	pad, err := s.GetPad("a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pad.Version != 0 || pad.Content != "" || pad.ParentPath != "a" || pad.CreatedAt != 0 {
+		t.Errorf("implicit pad = %+v", pad)
+	}
+	if exists, err := s.PathExists("a/b"); err != nil || exists {
+		t.Errorf("PathExists(implicit) = %v, %v", exists, err)
+	}
+
+	saved, err := s.SavePad("a/b", "hello", "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != 1 || saved.ParentPath != "a" || saved.CreatedBy != "ada" {
+		t.Errorf("saved pad = %+v", saved)
+	}
+	saved, err = s.SavePad("a/b", "hello again", "grace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != 2 || saved.CreatedBy != "ada" || saved.UpdatedBy != "grace" {
+		t.Errorf("resaved pad = %+v", saved)
+	}
+	if pad, err := s.GetPad("a/b"); err != nil || pad.Content != "hello again" || pad.Version != 2 {
+		t.Errorf("GetPad = %+v, %v", pad, err)
+	}
+	// Saving a pad doesn't create its ancestors.
+	if exists, err := s.PathExists("a"); err != nil || exists {
+		t.Errorf("PathExists(parent) = %v, %v", exists, err)
+	}
+}
+
+func TestPostgresDeleteSubtree(t *testing.T) {
+	s := newTestPostgresStore(t)
+	savePads(t, s, "a", "a/b", "a/b/c", "ab", "b")
+
+	if count, err := s.CountSubtree("a"); err != nil || count != 3 {
+		t.Errorf("CountSubtree(a) = %d, %v", count, err)
+	}
+	count, err := s.DeletePad("a")
+	if err != nil || count != 3 {
+		t.Fatalf("DeletePad(a) = %d, %v", count, err)
+	}
+	pads, err := s.GetSubtree("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, pad := range pads {
+		paths = append(paths, pad.Path)
+	}
+	if want := []string{"ab", "b"}; !slices.Equal(paths, want) {
+		t.Errorf("pads left = %v, want %v", paths, want)
+	}
+
+	if count, err := s.DeletePad(""); err != nil || count != 2 {
+		t.Errorf("DeletePad(root) = %d, %v", count, err)
+	}
+}
+
+func TestPostgresChildren(t *testing.T) {
+	s := newTestPostgresStore(t)
+	savePads(t, s, "", "b", "a", "a/x", "a/y/z", "a-b")
+
+	tests := map[string][]string{
+		"":    {"a", "a-b", "b"},
+		"a":   {"a/x"},
+		"a/y": {"a/y/z"},
+		"b":   nil,
+	}
+	for parent, want := range tests {
+		children, err := s.GetChildren(parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range children {
+			got = append(got, c.Path)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("GetChildren(%q) = %v, want %v", parent, got, want)
+		}
+	}
+}
+
+func TestPostgresSavePadIfVersion(t *testing.T) {
+	s := newTestPostgresStore(t)
+
+	pad, err := s.SavePadIfVersion("notes", "v1", 0, "ada")
+	if err != nil || pad.Version != 1 {
+		t.Fatalf("create = %+v, %v", pad, err)
+	}
+	if _, err := s.SavePadIfVersion("notes", "again", 0, "ada"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("create of an existing pad: %v, want ErrVersionConflict", err)
+	}
+	if _, err := s.SavePadIfVersion("notes", "stale", 2, "ada"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("save against a wrong version: %v, want ErrVersionConflict", err)
+	}
+	if _, err := s.SavePadIfVersion("other", "x", 1, "ada"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("save of a missing pad against version 1: %v, want ErrVersionConflict", err)
+	}
+	pad, err = s.SavePadIfVersion("notes", "v2", 1, "grace")
+	if err != nil || pad.Version != 2 || pad.Content != "v2" || pad.UpdatedBy != "grace" {
+		t.Fatalf("save = %+v, %v", pad, err)
+	}
+	if pad, _ := s.GetPad("notes"); pad.Content != "v2" {
+		t.Errorf("content after conflicts = %q, want v2", pad.Content)
+	}
+}
+
+func TestPostgresVersionsSurviveDelete(t *testing.T) {
+	s := newTestPostgresStore(t)
+	savePads(t, s, "notes", "notes", "notes/a")
+
+	if _, err := s.DeletePad("notes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SavePadIfVersion("notes", "new", 2, "ada"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("save against the deleted pad's version: %v, want ErrVersionConflict", err)
+	}
+	if pad, err := s.SavePadIfVersion("notes", "new", 0, "ada"); err != nil || pad.Version != 3 {
+		t.Errorf("recreate = %+v, %v, want version 3", pad, err)
+	}
+	if pad, err := s.SavePad("notes/a", "new", "ada"); err != nil || pad.Version != 2 {
+		t.Errorf("recreate descendant = %+v, %v, want version 2", pad, err)
+	}
+}
+
+func TestPostgresMigrationsIdempotent(t *testing.T) {
+	s := newTestPostgresStore(t)
+	latest := postgresMigrations[len(postgresMigrations)-1].version
+	savePads(t, s, "notes")
+
+	// Running the migrations again, directly or by reopening, changes
+	// nothing.
+	if version, err := s.migrator().run(); err != nil || version != latest {
+		t.Fatalf("migrate again = %d, %v; want %d", version, err, latest)
+	}
+	again, err := NewPostgresStore(os.Getenv("PATHPAD_TEST_POSTGRES_DSN"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+
+	history, err := again.SchemaHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != len(postgresMigrations) {
+		t.Fatalf("%d versions recorded, want %d", len(history), len(postgresMigrations))
+	}
+	for i, applied := range history {
+		if mig := postgresMigrations[i]; applied.Version != mig.version || applied.Description != mig.description || applied.AppliedAt == 0 {
+			t.Errorf("history[%d] = %+v", i, applied)
+		}
+	}
+	if pad, err := again.GetPad("notes"); err != nil || pad.Version != 1 {
+		t.Errorf("pad after remigrating = %+v, %v", pad, err)
+	}
+
+	// Replaying every migration's SQL is harmless too, so a migration
+	// interrupted after its DDL can be rerun.
+	for _, mig := range postgresMigrations {
+		if _, err := s.db.Exec(mig.sql); err != nil {
+			t.Errorf("rerun migration v%d: %v", mig.version, err)
+		}
+	}
+}
+
+func TestPostgresSchemaTooNew(t *testing.T) {
+	s := newTestPostgresStore(t)
+	if _, err := s.db.Exec(`
+		DROP TABLE schema_version;
+		CREATE TABLE schema_version (version INTEGER NOT NULL);
+		INSERT INTO schema_version VALUES (999);
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.migrator().run(); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("migrate newer database: %v, want ErrSchemaTooNew", err)
+	}
+	var columns int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns WHERE table_name = 'schema_version'`).Scan(&columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns != 1 {
+		t.Errorf("schema_version has %d columns after refusing to migrate, want 1", columns)
+	}
+}
+
+func TestPostgresWatchAccess(t *testing.T) {
+	s := newTestPostgresStore(t)
+
+	changed := make(chan struct{}, 10)
+	stop, err := s.WatchAccess(func() { changed <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	if _, err := s.SetAccessRule("team", models.ModePrivate); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification after changing a rule")
+	}
+	rules, err := s.ListAccessRules()
+	if err != nil || len(rules) != 1 || rules[0].Prefix != "team" || rules[0].Mode != models.ModePrivate {
+		t.Errorf("ListAccessRules = %+v, %v", rules, err)
+	}
+}
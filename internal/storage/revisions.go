@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// ErrRevisionNotFound is returned when a requested revision does not exist.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// SetRevisionRetention configures how many revisions are kept per pad and
+// how old they may get. Zero disables the corresponding limit.
+func (s *SQLiteStore) SetRevisionRetention(maxRevisions int, maxAge time.Duration) {
+	s.maxRevisions = maxRevisions
+	s.maxRevisionAge = maxAge
+}
+
+// recordRevision stores the content of a pad version as a revision and prunes
+// old ones according to the retention settings. Revision numbers equal the
+// pad version they were saved as.
+func (s *SQLiteStore) recordRevision(tx *sql.Tx, path string, rev int64, content string, now int64, author string) error {
+	_, err := tx.Exec(
+		`INSERT OR REPLACE INTO pad_revisions (path, rev, content, created_at, created_by) VALUES (?, ?, ?, ?, ?)`,
+		path, rev, content, now, author,
+	)
+	if err != nil {
+		return fmt.Errorf("record revision %q: %w", path, err)
+	}
+	return s.pruneRevisions(tx, &path)
+}
+
+// PruneRevisions removes revisions beyond the configured retention limits
+// for all pads. The latest revision of each pad is always kept.
+func (s *SQLiteStore) PruneRevisions() error {
+	return s.pruneRevisions(s.db, nil)
+}
+
+// pruneRevisions applies the retention limits, either to a single pad path
+// or to every pad when path is nil.
+func (s *SQLiteStore) pruneRevisions(db execer, path *string) error {
+	scope := ""
+	var args []interface{}
+	if path != nil {
+		scope = "WHERE path = ?"
+		args = append(args, *path)
+	}
+
+	if s.maxRevisions > 0 {
+		_, err := db.Exec(`
+			DELETE FROM pad_revisions WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY path ORDER BY rev DESC) AS n
+					FROM pad_revisions `+scope+`
+				) WHERE n > ?
+			)
+		`, append(args, s.maxRevisions)...)
+		if err != nil {
+			return fmt.Errorf("prune revisions by count: %w", err)
+		}
+	}
+
+	if s.maxRevisionAge > 0 {
+		cutoff := time.Now().Add(-s.maxRevisionAge).Unix()
+		_, err := db.Exec(`
+			DELETE FROM pad_revisions WHERE id IN (
+				SELECT id FROM (
+					SELECT id, created_at, ROW_NUMBER() OVER (PARTITION BY path ORDER BY rev DESC) AS n
+					FROM pad_revisions `+scope+`
+				) WHERE n > 1 AND created_at < ?
+			)
+		`, append(args, cutoff)...)
+		if err != nil {
+			return fmt.Errorf("prune revisions by age: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListRevisions returns the revision history of a pad, newest first.
+// Revision content is not included.
+func (s *SQLiteStore) ListRevisions(path string) ([]models.Revision, error) {
+	rows, err := s.db.Query(
+		`SELECT rev, LENGTH(CAST(content AS BLOB)), created_at, created_by FROM pad_revisions WHERE path = ? ORDER BY rev DESC`,
+		path,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions of %q: %w", path, err)
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+	for rows.Next() {
+		rev := models.Revision{Path: path}
+		if err := rows.Scan(&rev.Rev, &rev.Size, &rev.CreatedAt, &rev.CreatedBy); err != nil {
+			return nil, fmt.Errorf("scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// GetRevision returns a single revision of a pad including its content.
+// Returns ErrRevisionNotFound if the revision doesn't exist.
+func (s *SQLiteStore) GetRevision(path string, rev int64) (*models.Revision, error) {
+	revision := &models.Revision{Path: path, Rev: rev}
+	err := s.db.QueryRow(
+		`SELECT content, created_at, created_by FROM pad_revisions WHERE path = ? AND rev = ?`,
+		path, rev,
+	).Scan(&revision.Content, &revision.CreatedAt, &revision.CreatedBy)
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get revision %d of %q: %w", rev, path, err)
+	}
+	revision.Size = len(revision.Content)
+	return revision, nil
+}
+
+// RestoreRevision makes the content of a previous revision the pad's current
+// content. The restore is recorded as a new revision by author, so it can be
+// undone. Returns ErrRevisionNotFound if the revision doesn't exist.
+func (s *SQLiteStore) RestoreRevision(path string, rev int64, author string) (*models.Pad, error) {
+	revision, err := s.GetRevision(path, rev)
+	if err != nil {
+		return nil, err
+	}
+	return s.SavePad(path, revision.Content, author)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"pathpad/internal/models"
+)
+
+// Snippet match delimiters. Control characters can't clash with the markup
+// they are replaced with after the snippet has been HTML-escaped.
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// SearchPads runs a full-text search over pad paths and content, returning
+// at most limit results ordered by relevance. A non-empty prefix limits the
+// search to that pad and its descendants.
+func (s *SQLiteStore) SearchPads(query, prefix string, limit int) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	match := matchQuery(query)
+	if match == "" {
+		return results, nil
+	}
+
+	sqlQuery := `
+		SELECT pads_fts.path,
+			snippet(pads_fts, 1, char(2), char(3), '…', 16),
+			pads.updated_at
+		FROM pads_fts JOIN pads ON pads.path = pads_fts.path
+		WHERE pads_fts MATCH ?`
+	args := []interface{}{match}
+	if prefix != "" {
+		sqlQuery += ` AND (pads_fts.path = ? OR substr(pads_fts.path, 1, ?) = ?)`
+		args = append(args, prefix, len(prefix)+1, prefix+"/")
+	}
+	// Matches in the path weigh more than matches in the content.
+	sqlQuery += ` ORDER BY bm25(pads_fts, 2.0, 1.0) LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search pads %q: %w", query, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result models.SearchResult
+		if err := rows.Scan(&result.Path, &result.Snippet, &result.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan search result: %w", err)
+		}
+		result.Snippet = highlightSnippet(result.Snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate search results: %w", err)
+	}
+	return results, nil
+}
+
+// matchQuery turns free-form input into an FTS5 query. Every term must match,
+// and the last one also matches as a prefix to support search-as-you-type.
+// Terms are quoted so FTS5 operators in the input are taken literally.
+func matchQuery(query string) string {
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		// Skip terms without any token characters; they would never match.
+		if !strings.ContainsFunc(term, isTokenRune) {
+			continue
+		}
+		terms = append(terms, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+// isTokenRune approximates the unicode61 tokenizer's token characters.
+func isTokenRune(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127
+}
+
+// highlightSnippet HTML-escapes a snippet and marks up the matches.
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, matchStart, "<mark>")
+	return strings.ReplaceAll(snippet, matchEnd, "</mark>")
+}
@@ -0,0 +1,136 @@
+//go:build sqlite_fts5
+
+package storage
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "pathpad.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// searchPaths returns the sorted paths of the pads matching query.
+func searchPaths(t *testing.T, s *SQLiteStore, query string) []string {
+	t.Helper()
+	results, err := s.SearchPads(query, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range results {
+		paths = append(paths, r.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// checkIndex fails unless the search index holds exactly one row per pad,
+// each under the rowid its path is mapped to.
+func checkIndex(t *testing.T, s *SQLiteStore) {
+	t.Helper()
+	var pads, indexed, mapped int
+	err := s.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM pads),
+			(SELECT COUNT(*) FROM pads_fts),
+			(SELECT COUNT(*) FROM pads
+				JOIN pads_fts_map ON pads_fts_map.path = pads.path
+				JOIN pads_fts ON pads_fts.rowid = pads_fts_map.fts_rowid AND pads_fts.path = pads.path)
+	`).Scan(&pads, &indexed, &mapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed != pads || mapped != pads {
+		t.Fatalf("%d pads, %d index rows, %d mapped to their pad", pads, indexed, mapped)
+	}
+}
+
+func TestSearchIndexFollowsPads(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	for _, path := range []string{"notes", "notes/a", "notes/b", "other"} {
+		if _, err := s.SavePad(path, "needle in "+path, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkIndex(t, s)
+
+	if _, err := s.SavePad("other", "haystack", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searchPaths(t, s, "needle"), []string{"notes", "notes/a", "notes/b"}; !slices.Equal(got, want) {
+		t.Errorf("after edit: search = %v, want %v", got, want)
+	}
+	if got, want := searchPaths(t, s, "haystack"), []string{"other"}; !slices.Equal(got, want) {
+		t.Errorf("after edit: search = %v, want %v", got, want)
+	}
+
+	if _, err := s.MovePad("notes", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	checkIndex(t, s)
+	if got, want := searchPaths(t, s, "needle"), []string{"moved", "moved/a", "moved/b"}; !slices.Equal(got, want) {
+		t.Errorf("after move: search = %v, want %v", got, want)
+	}
+
+	if _, err := s.DeletePad("moved/a"); err != nil {
+		t.Fatal(err)
+	}
+	checkIndex(t, s)
+	if got, want := searchPaths(t, s, "needle"), []string{"moved", "moved/b"}; !slices.Equal(got, want) {
+		t.Errorf("after delete: search = %v, want %v", got, want)
+	}
+
+	if _, err := s.RestoreTrash("moved/a", 0); err != nil {
+		t.Fatal(err)
+	}
+	checkIndex(t, s)
+	if got, want := searchPaths(t, s, "needle"), []string{"moved", "moved/a", "moved/b"}; !slices.Equal(got, want) {
+		t.Errorf("after restore: search = %v, want %v", got, want)
+	}
+}
+
+func TestSearchIndexMigration(t *testing.T) {
+	s := newTestSQLiteStore(t)
+
+	// Roll the database back to before the index was keyed by rowid, with
+	// pads indexed by the old triggers.
+	_, err := s.db.Exec(`
+		DROP TRIGGER pads_fts_insert;
+		DROP TRIGGER pads_fts_update;
+		DROP TRIGGER pads_fts_delete;
+		DROP TABLE pads_fts_map;
+		DELETE FROM schema_version WHERE version >= 10;
+		CREATE TRIGGER pads_fts_insert AFTER INSERT ON pads BEGIN
+			INSERT INTO pads_fts (path, content) VALUES (new.path, new.content);
+		END;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"a", "a/b", "c"} {
+		if _, err := s.SavePad(path, "needle in "+path, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.migrate(); err != nil {
+		t.Fatal(err)
+	}
+	checkIndex(t, s)
+	if got, want := searchPaths(t, s, "needle"), []string{"a", "a/b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("search = %v, want %v", got, want)
+	}
+	if _, err := s.DeletePad("a"); err != nil {
+		t.Fatal(err)
+	}
+	checkIndex(t, s)
+}
@@ -3,9 +3,9 @@ package storage
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -13,11 +13,16 @@ import (
 	"pathpad/internal/models"
 )
 
-const currentSchemaVersion = 1
-
 // SQLiteStore provides persistent storage using SQLite.
 type SQLiteStore struct {
 	db *sql.DB
+
+	// Revision retention limits. Zero disables the corresponding limit.
+	maxRevisions   int
+	maxRevisionAge time.Duration
+
+	// How long deleted pads stay in the trash. Zero keeps them forever.
+	trashRetention time.Duration
 }
 
 // NewSQLiteStore opens (or creates) the SQLite database and runs migrations.
@@ -30,7 +35,7 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
@@ -50,42 +55,210 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 	return store, nil
 }
 
-// migrate runs schema migrations.
-func (s *SQLiteStore) migrate() error {
-	// Create schema_version table if not exists.
-	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`)
-	if err != nil {
-		return fmt.Errorf("create schema_version table: %w", err)
+// sqliteMigrations is the SQLite schema, oldest change first. Append new
+// migrations to the end; never edit one that has been released.
+var sqliteMigrations = []migration{
+	{1, "create pads table", `
+		CREATE TABLE IF NOT EXISTS pads (
+			path TEXT PRIMARY KEY,
+			content TEXT NOT NULL DEFAULT '',
+			parent_path TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_parent_path ON pads(parent_path);
+		CREATE INDEX IF NOT EXISTS idx_updated_at ON pads(updated_at);
+	`},
+	{2, "create pad_revisions table", `
+		CREATE TABLE IF NOT EXISTS pad_revisions (
+			id INTEGER PRIMARY KEY,
+			path TEXT NOT NULL,
+			rev INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_revisions_path_rev ON pad_revisions(path, rev);
+		CREATE INDEX IF NOT EXISTS idx_revisions_created_at ON pad_revisions(created_at);
+		INSERT INTO pad_revisions (path, rev, content, created_at)
+			SELECT path, 1, content, updated_at FROM pads;
+	`},
+	{3, "add pads.version column", `
+		ALTER TABLE pads ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+		UPDATE pads SET version = COALESCE(
+			(SELECT MAX(rev) FROM pad_revisions WHERE pad_revisions.path = pads.path), 1
+		);
+	`},
+	// The index keeps its own copy of the content instead of using external
+	// content, because pads' implicit rowids may change on VACUUM.
+	{4, "create pads_fts search index", `
+		CREATE VIRTUAL TABLE IF NOT EXISTS pads_fts USING fts5(path, content, tokenize = 'unicode61');
+		CREATE TRIGGER IF NOT EXISTS pads_fts_insert AFTER INSERT ON pads BEGIN
+			INSERT INTO pads_fts (path, content) VALUES (new.path, new.content);
+		END;
+		CREATE TRIGGER IF NOT EXISTS pads_fts_update AFTER UPDATE OF path, content ON pads BEGIN
+			DELETE FROM pads_fts WHERE path = old.path;
+			INSERT INTO pads_fts (path, content) VALUES (new.path, new.content);
+		END;
+		CREATE TRIGGER IF NOT EXISTS pads_fts_delete AFTER DELETE ON pads BEGIN
+			DELETE FROM pads_fts WHERE path = old.path;
+		END;
+		INSERT INTO pads_fts (path, content) SELECT path, content FROM pads;
+	`},
+	{5, "create trash tables", `
+		CREATE TABLE IF NOT EXISTS trash (
+			id INTEGER PRIMARY KEY,
+			batch INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			parent_path TEXT NOT NULL,
+			content TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			deleted_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_trash_path ON trash(path);
+		CREATE INDEX IF NOT EXISTS idx_trash_batch ON trash(batch);
+		CREATE INDEX IF NOT EXISTS idx_trash_deleted_at ON trash(deleted_at);
+		CREATE TABLE IF NOT EXISTS trash_revisions (
+			trash_id INTEGER NOT NULL,
+			rev INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_trash_revisions_trash_id ON trash_revisions(trash_id);
+	`},
+	{6, "create access control tables", `
+		CREATE TABLE IF NOT EXISTS access_rules (
+			prefix TEXT PRIMARY KEY,
+			mode TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS access_tokens (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL,
+			access TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+	`},
+	{7, "create pad_locks table", `
+		CREATE TABLE IF NOT EXISTS pad_locks (
+			prefix TEXT PRIMARY KEY,
+			password_hash TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+	`},
+	{8, "add author columns", `
+		ALTER TABLE pads ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+		ALTER TABLE pads ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+		ALTER TABLE pad_revisions ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+		ALTER TABLE trash ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+		ALTER TABLE trash ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+		ALTER TABLE trash_revisions ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+	`},
+	{9, "create api_keys table", `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			rate_limit INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL DEFAULT 0
+		);
+	`},
+	// Deleting index rows by path scans the whole index, since FTS5 can only
+	// look rows up by rowid. pads_fts_map assigns each pad a stable index
+	// rowid so the triggers can find its row directly.
+	{10, "key pads_fts rows by rowid", `
+		DROP TRIGGER IF EXISTS pads_fts_insert;
+		DROP TRIGGER IF EXISTS pads_fts_update;
+		DROP TRIGGER IF EXISTS pads_fts_delete;
+		CREATE TABLE IF NOT EXISTS pads_fts_map (
+			fts_rowid INTEGER PRIMARY KEY,
+			path TEXT NOT NULL UNIQUE
+		);
+		DELETE FROM pads_fts;
+		INSERT INTO pads_fts_map (path) SELECT path FROM pads;
+		INSERT INTO pads_fts (rowid, path, content)
+			SELECT pads_fts_map.fts_rowid, pads.path, pads.content
+			FROM pads JOIN pads_fts_map ON pads_fts_map.path = pads.path;
+		CREATE TRIGGER pads_fts_insert AFTER INSERT ON pads BEGIN
+			INSERT INTO pads_fts_map (path) VALUES (new.path);
+			INSERT INTO pads_fts (rowid, path, content) VALUES (
+				(SELECT fts_rowid FROM pads_fts_map WHERE path = new.path), new.path, new.content
+			);
+		END;
+		CREATE TRIGGER pads_fts_update AFTER UPDATE OF path, content ON pads BEGIN
+			UPDATE pads_fts_map SET path = new.path WHERE path = old.path;
+			UPDATE pads_fts SET path = new.path, content = new.content
+				WHERE rowid = (SELECT fts_rowid FROM pads_fts_map WHERE path = new.path);
+		END;
+		CREATE TRIGGER pads_fts_delete AFTER DELETE ON pads BEGIN
+			DELETE FROM pads_fts WHERE rowid = (SELECT fts_rowid FROM pads_fts_map WHERE path = old.path);
+			DELETE FROM pads_fts_map WHERE path = old.path;
+		END;
+	`},
+	// Pads deleted before this migration only left their versions in the
+	// trash.
+	{11, "create vacated_paths table", `
+		CREATE TABLE IF NOT EXISTS vacated_paths (
+			path TEXT PRIMARY KEY,
+			version INTEGER NOT NULL
+		);
+		INSERT INTO vacated_paths (path, version)
+			SELECT path, MAX(version) FROM trash GROUP BY path;
+	`},
+}
+
+// migrator returns the migrator for the SQLite schema. Transactions take the
+// write lock when they begin (_txlock=immediate), so concurrent processes
+// migrate one at a time.
+func (s *SQLiteStore) migrator() *migrator {
+	return &migrator{
+		db:         s.db,
+		migrations: sqliteMigrations,
+		begin:      s.db.Begin,
+		versioned: func() (bool, error) {
+			var count int
+			err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&count)
+			return count > 0, err
+		},
+		addColumns: func(tx *sql.Tx) error {
+			var count int
+			err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('schema_version') WHERE name = 'applied_at'`).Scan(&count)
+			if err != nil || count > 0 {
+				return err
+			}
+			_, err = tx.Exec(`
+				ALTER TABLE schema_version ADD COLUMN description TEXT;
+				ALTER TABLE schema_version ADD COLUMN applied_at INTEGER;
+			`)
+			return err
+		},
 	}
+}
 
-	// Get current version.
-	var version int
-	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
-	if err != nil {
-		return fmt.Errorf("get schema version: %w", err)
-	}
-
-	if version < 1 {
-		log.Println("[db] Running migration v1: create pads table")
-		_, err = s.db.Exec(`
-			CREATE TABLE IF NOT EXISTS pads (
-				path TEXT PRIMARY KEY,
-				content TEXT NOT NULL DEFAULT '',
-				parent_path TEXT NOT NULL DEFAULT '',
-				updated_at INTEGER NOT NULL,
-				created_at INTEGER NOT NULL
-			);
-			CREATE INDEX IF NOT EXISTS idx_parent_path ON pads(parent_path);
-			CREATE INDEX IF NOT EXISTS idx_updated_at ON pads(updated_at);
-			INSERT OR REPLACE INTO schema_version (version) VALUES (1);
-		`)
-		if err != nil {
-			return fmt.Errorf("migration v1: %w", err)
-		}
+// migrate runs pending schema migrations.
+func (s *SQLiteStore) migrate() error {
+	_, err := s.migrator().run()
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		return fmt.Errorf("SQLite was built without FTS5 (build with -tags sqlite_fts5): %w", err)
 	}
+	return err
+}
 
-	log.Printf("[db] Schema at version %d\n", currentSchemaVersion)
-	return nil
+// SchemaHistory lists the schema versions applied to the database, oldest
+// first.
+func (s *SQLiteStore) SchemaHistory() ([]AppliedMigration, error) {
+	return s.migrator().history()
 }
 
 // Ping checks database connectivity.
@@ -98,19 +271,29 @@ func (s *SQLiteStore) Close() error {
 	return s.db.Close()
 }
 
-// GetPad retrieves a pad by path. Returns an empty pad (with zero timestamps)
-// if the pad doesn't exist in the database (implicit pad).
+// Vacuum rebuilds the database file, returning the space freed by deleted
+// pads and pruned revisions to the filesystem.
+func (s *SQLiteStore) Vacuum() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	return nil
+}
+
+// GetPad retrieves a pad by path. Returns an empty pad (with zero timestamps
+// and version) if the pad doesn't exist in the database (implicit pad).
 func (s *SQLiteStore) GetPad(path string) (*models.Pad, error) {
 	pad := &models.Pad{Path: path}
 	err := s.db.QueryRow(
-		`SELECT content, parent_path, updated_at, created_at FROM pads WHERE path = ?`,
+		`SELECT content, parent_path, version, updated_at, created_at, updated_by, created_by FROM pads WHERE path = ?`,
 		path,
-	).Scan(&pad.Content, &pad.ParentPath, &pad.UpdatedAt, &pad.CreatedAt)
+	).Scan(&pad.Content, &pad.ParentPath, &pad.Version, &pad.UpdatedAt, &pad.CreatedAt, &pad.UpdatedBy, &pad.CreatedBy)
 
 	if err == sql.ErrNoRows {
 		// Implicit pad: exists conceptually but not in DB.
 		pad.Content = ""
 		pad.ParentPath = models.ParentPath(path)
+		pad.Version = 0
 		pad.UpdatedAt = 0
 		pad.CreatedAt = 0
 		return pad, nil
@@ -122,42 +305,150 @@ func (s *SQLiteStore) GetPad(path string) (*models.Pad, error) {
 }
 
 // SavePad upserts a pad's content. Creates the row if it doesn't exist,
-// updates it if it does. Returns the saved pad.
-func (s *SQLiteStore) SavePad(path, content string) (*models.Pad, error) {
-	now := time.Now().Unix()
-	parentPath := models.ParentPath(path)
-
-	_, err := s.db.Exec(`
-		INSERT INTO pads (path, content, parent_path, updated_at, created_at)
-		VALUES (?, ?, ?, ?, ?)
-		ON CONFLICT(path) DO UPDATE SET
-			content = excluded.content,
-			updated_at = excluded.updated_at
-	`, path, content, parentPath, now, now)
+// updates it if it does. Every save bumps the pad's version and is recorded
+// as a revision. Returns the saved pad.
+func (s *SQLiteStore) SavePad(path, content, author string) (*models.Pad, error) {
+	return s.savePad(path, content, nil, author)
+}
+
+// SavePadIfVersion saves a pad only if its current version equals
+// expectedVersion (0 for a pad that doesn't exist yet). Returns
+// ErrVersionConflict otherwise.
+func (s *SQLiteStore) SavePadIfVersion(path, content string, expectedVersion int64, author string) (*models.Pad, error) {
+	return s.savePad(path, content, &expectedVersion, author)
+}
+
+func (s *SQLiteStore) savePad(path, content string, expectedVersion *int64, author string) (*models.Pad, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("save pad %q: %w", path, err)
+		return nil, fmt.Errorf("begin save pad %q: %w", path, err)
+	}
+	defer tx.Rollback()
+
+	if err := s.savePadTx(tx, path, content, expectedVersion, time.Now().Unix(), author); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit save pad %q: %w", path, err)
 	}
 
 	// Retrieve the saved pad (to get the correct created_at for existing pads).
 	return s.GetPad(path)
 }
 
-// DeletePad deletes a pad and all its descendants. Returns the count of deleted rows.
+// savePadTx upserts a pad within tx, bumping its version and recording the
+// new content as a revision by author.
+func (s *SQLiteStore) savePadTx(tx *sql.Tx, path, content string, expectedVersion *int64, now int64, author string) error {
+	var version int64
+	err := tx.QueryRow(`SELECT version FROM pads WHERE path = ?`, path).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("get version of %q: %w", path, err)
+	}
+	if expectedVersion != nil && *expectedVersion != version {
+		return ErrVersionConflict
+	}
+	if err == sql.ErrNoRows {
+		if version, err = vacatedVersion(tx, path); err != nil {
+			return err
+		}
+	}
+	version++
+
+	_, err = tx.Exec(`
+		INSERT INTO pads (path, content, parent_path, version, updated_at, created_at, updated_by, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			content = excluded.content,
+			version = excluded.version,
+			updated_at = excluded.updated_at,
+			updated_by = excluded.updated_by
+	`, path, content, models.ParentPath(path), version, now, now, author, author)
+	if err != nil {
+		return fmt.Errorf("save pad %q: %w", path, err)
+	}
+
+	return s.recordRevision(tx, path, version, content, now, author)
+}
+
+// vacatePads records the versions of the pads matching where before they are
+// deleted or moved away, so that a pad later saved at the same path continues
+// from there. Otherwise a client still holding the old pad's version could
+// save over the new pad as if it were the old one.
+func vacatePads(tx *sql.Tx, where string, args []interface{}) error {
+	_, err := tx.Exec(`
+		INSERT INTO vacated_paths (path, version)
+		SELECT path, version FROM pads WHERE `+where+`
+		ON CONFLICT(path) DO UPDATE SET version = MAX(version, excluded.version)
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("record vacated versions: %w", err)
+	}
+	return nil
+}
+
+// vacatedVersion returns the highest version a pad at path had before it was
+// deleted or moved away, 0 if there never was one.
+func vacatedVersion(tx *sql.Tx, path string) (int64, error) {
+	var version int64
+	err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM vacated_paths WHERE path = ?`, path).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("get vacated version of %q: %w", path, err)
+	}
+	return version, nil
+}
+
+// CountSubtree returns the number of stored pads in the subtree rooted at
+// path, including path itself. This is how many pads DeletePad would remove.
+func (s *SQLiteStore) CountSubtree(path string) (int64, error) {
+	where, args := subtreeFilter(path)
+	var count int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM pads WHERE `+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count subtree of %q: %w", path, err)
+	}
+	return count, nil
+}
+
+// DeletePad moves a pad and all its descendants, along with their revision
+// history, to the trash. Pads deleted together form one batch and are
+// restored together. Returns the count of deleted pads.
 func (s *SQLiteStore) DeletePad(path string) (int64, error) {
-	var result sql.Result
-	var err error
-
-	if path == "" {
-		// Root: delete everything.
-		result, err = s.db.Exec(`DELETE FROM pads`)
-	} else {
-		// Delete the pad itself and all descendants.
-		// Descendants have path starting with "path/" or parent_path starting with "path".
-		result, err = s.db.Exec(
-			`DELETE FROM pads WHERE path = ? OR path LIKE ? || '/%'`,
-			path, path,
-		)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin delete pad %q: %w", path, err)
+	}
+	defer tx.Rollback()
+
+	where, args := subtreeFilter(path)
+
+	var batch int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(batch), 0) + 1 FROM trash`).Scan(&batch); err != nil {
+		return 0, fmt.Errorf("next trash batch: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO trash (batch, path, parent_path, content, version, updated_at, created_at, updated_by, created_by, deleted_at)
+		SELECT ?, path, parent_path, content, version, updated_at, created_at, updated_by, created_by, ? FROM pads WHERE `+where,
+		append([]interface{}{batch, time.Now().Unix()}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("trash pad %q: %w", path, err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO trash_revisions (trash_id, rev, content, created_at, created_by)
+		SELECT trash.id, pad_revisions.rev, pad_revisions.content, pad_revisions.created_at, pad_revisions.created_by
+		FROM pad_revisions JOIN trash ON trash.path = pad_revisions.path AND trash.batch = ?
+	`, batch)
+	if err != nil {
+		return 0, fmt.Errorf("trash revisions of %q: %w", path, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM pad_revisions WHERE `+where, args...); err != nil {
+		return 0, fmt.Errorf("delete revisions of %q: %w", path, err)
+	}
+	if err := vacatePads(tx, where, args); err != nil {
+		return 0, err
 	}
+	result, err := tx.Exec(`DELETE FROM pads WHERE `+where, args...)
 	if err != nil {
 		return 0, fmt.Errorf("delete pad %q: %w", path, err)
 	}
@@ -166,9 +457,40 @@ func (s *SQLiteStore) DeletePad(path string) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("rows affected: %w", err)
 	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit delete pad %q: %w", path, err)
+	}
 	return count, nil
 }
 
+// GetSubtree returns the stored pads in the subtree rooted at path, including
+// path itself, sorted by path.
+func (s *SQLiteStore) GetSubtree(path string) ([]*models.Pad, error) {
+	where, args := subtreeFilter(path)
+	rows, err := s.db.Query(`
+		SELECT path, content, parent_path, version, updated_at, created_at, updated_by, created_by
+		FROM pads WHERE `+where+` ORDER BY path ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get subtree of %q: %w", path, err)
+	}
+	defer rows.Close()
+
+	pads := []*models.Pad{}
+	for rows.Next() {
+		pad := &models.Pad{}
+		if err := rows.Scan(&pad.Path, &pad.Content, &pad.ParentPath, &pad.Version, &pad.UpdatedAt, &pad.CreatedAt, &pad.UpdatedBy, &pad.CreatedBy); err != nil {
+			return nil, fmt.Errorf("scan pad: %w", err)
+		}
+		pads = append(pads, pad)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate subtree: %w", err)
+	}
+	return pads, nil
+}
+
 // GetChildren returns all direct children of a given path that have content.
 // Children are sorted alphabetically by path.
 func (s *SQLiteStore) GetChildren(parentPath string) ([]models.ChildPad, error) {
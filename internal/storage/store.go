@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"errors"
+
+	"pathpad/internal/models"
+)
+
+var (
+	// ErrVersionConflict is returned by a conditional save when the pad's
+	// current version doesn't match the expected one.
+	ErrVersionConflict = errors.New("version conflict")
+
+	// ErrPadNotFound is returned when an operation needs a stored pad but
+	// neither it nor any descendant exists.
+	ErrPadNotFound = errors.New("pad not found")
+
+	// ErrDestinationExists is returned when moving or copying onto a path
+	// that already has a pad or descendants.
+	ErrDestinationExists = errors.New("destination already exists")
+
+	// ErrInvalidDestination wraps the validation error of a path that a
+	// move or copy would create.
+	ErrInvalidDestination = errors.New("invalid destination")
+)
+
+// Store is a pad storage backend.
+//
+// Pads are implicit: GetPad returns an empty pad with zero version and
+// timestamps for a path that was never saved. Deleting a pad also deletes
+// all its descendants. Writes take the name of their author, which is empty
+// when it is unknown.
+type Store interface {
+	// GetPad retrieves a pad by path, or an implicit pad if it isn't stored.
+	GetPad(path string) (*models.Pad, error)
+
+	// SavePad creates or updates a pad, bumping its version.
+	SavePad(path, content, author string) (*models.Pad, error)
+
+	// SavePadIfVersion saves a pad only if its current version equals
+	// expectedVersion (0 for a pad that doesn't exist yet). Returns
+	// ErrVersionConflict otherwise.
+	SavePadIfVersion(path, content string, expectedVersion int64, author string) (*models.Pad, error)
+
+	// DeletePad deletes a pad and all its descendants and returns how many
+	// stored pads were removed.
+	DeletePad(path string) (int64, error)
+
+	// CountSubtree returns how many stored pads DeletePad(path) would remove.
+	CountSubtree(path string) (int64, error)
+
+	// GetSubtree returns the stored pads in the subtree rooted at path,
+	// including path itself, sorted by path.
+	GetSubtree(path string) ([]*models.Pad, error)
+
+	// GetChildren lists the stored direct children of a pad, sorted by path.
+	GetChildren(parentPath string) ([]models.ChildPad, error)
+
+	// PathExists reports whether a pad is stored at path.
+	PathExists(path string) (bool, error)
+
+	// Ping checks that the backend is reachable.
+	Ping() error
+
+	// Close releases the backend's resources.
+	Close() error
+}
+
+// The interfaces below are optional features a Store may implement. Handlers
+// check for them with a type assertion and report unsupported features.
+
+// Searcher is a Store supporting full-text search.
+type Searcher interface {
+	SearchPads(query, prefix string, limit int) ([]models.SearchResult, error)
+}
+
+// RevisionStore is a Store keeping the revision history of pads.
+type RevisionStore interface {
+	ListRevisions(path string) ([]models.Revision, error)
+	GetRevision(path string, rev int64) (*models.Revision, error)
+	RestoreRevision(path string, rev int64, author string) (*models.Pad, error)
+}
+
+// Mover is a Store that can move and copy whole subtrees.
+type Mover interface {
+	MovePad(src, dst string) (int64, error)
+	CopyPad(src, dst string, overwrite bool, author string) ([]*models.Pad, error)
+}
+
+// TrashStore is a Store that keeps deleted pads in a trash bin.
+type TrashStore interface {
+	ListTrash() ([]models.TrashedPad, error)
+	RestoreTrash(path string, id int64) ([]*models.Pad, error)
+}
+
+// Importer is a Store that can import many pads at once.
+type Importer interface {
+	ImportPads(root string, pads []*models.Pad, onConflict string, dryRun bool, author string) ([]models.ImportedPad, error)
+}
+
+// Backuper is a Store that can write a consistent snapshot of itself to a
+// file while it is in use.
+type Backuper interface {
+	Backup(destPath string) error
+}
+
+// AccessStore is a Store that keeps access rules, access tokens, API keys,
+// password locks and the settings they depend on.
+type AccessStore interface {
+	ListAccessRules() ([]models.AccessRule, error)
+	SetAccessRule(prefix, mode string) (*models.AccessRule, error)
+	DeleteAccessRule(prefix string) error
+
+	CreateAccessToken(token *models.AccessToken, hash string) error
+	ListAccessTokens() ([]models.AccessToken, error)
+	LookupAccessToken(hash string) (*models.AccessToken, error)
+	DeleteAccessToken(id int64) error
+
+	CreateAPIKey(key *models.APIKey, hash string) error
+	ListAPIKeys() ([]models.APIKey, error)
+	LookupAPIKey(hash string) (*models.APIKey, error)
+	DeleteAPIKey(id int64) error
+
+	ListPadLocks() ([]models.PadLock, error)
+	SetPadLock(prefix, hash string) (*models.PadLock, error)
+	DeletePadLock(prefix string) error
+
+	Setting(key string) (string, error)
+	SetSetting(key, value string) error
+}
+
+// AccessWatcher is an AccessStore shared by several servers, any of which
+// may change the access control state the others keep in memory.
+type AccessWatcher interface {
+	// WatchAccess calls onChange whenever the access control state may have
+	// changed, until the returned stop function is called.
+	WatchAccess(onChange func()) (stop func() error, err error)
+}
+
+// Watcher is a Store whose pads can also be changed from outside Pathpad.
+type Watcher interface {
+	// Watch calls onChange with the paths of pads changed externally until
+	// the returned stop function is called.
+	Watch(onChange func(paths []string)) (stop func() error, err error)
+}
+
+var (
+	_ Store         = (*SQLiteStore)(nil)
+	_ Searcher      = (*SQLiteStore)(nil)
+	_ RevisionStore = (*SQLiteStore)(nil)
+	_ Mover         = (*SQLiteStore)(nil)
+	_ TrashStore    = (*SQLiteStore)(nil)
+	_ Importer      = (*SQLiteStore)(nil)
+	_ Backuper      = (*SQLiteStore)(nil)
+	_ AccessStore   = (*SQLiteStore)(nil)
+
+	_ Store         = (*PostgresStore)(nil)
+	_ AccessStore   = (*PostgresStore)(nil)
+	_ AccessWatcher = (*PostgresStore)(nil)
+
+	_ Store   = (*FileStore)(nil)
+	_ Watcher = (*FileStore)(nil)
+	_ Store   = (*MemoryStore)(nil)
+)
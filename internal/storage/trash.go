@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pathpad/internal/models"
+)
+
+// ErrNotInTrash is returned when restoring a pad that isn't in the trash.
+var ErrNotInTrash = errors.New("pad not found in trash")
+
+// SetTrashRetention configures how long deleted pads are kept before
+// PurgeTrash removes them for good. Zero keeps them forever.
+func (s *SQLiteStore) SetTrashRetention(retention time.Duration) {
+	s.trashRetention = retention
+}
+
+// ListTrash returns all pads in the trash, most recently deleted first.
+func (s *SQLiteStore) ListTrash() ([]models.TrashedPad, error) {
+	rows, err := s.db.Query(`
+		SELECT id, batch, path, LENGTH(CAST(content AS BLOB)), updated_at, deleted_at
+		FROM trash ORDER BY deleted_at DESC, batch DESC, path ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list trash: %w", err)
+	}
+	defer rows.Close()
+
+	trashed := []models.TrashedPad{}
+	for rows.Next() {
+		var t models.TrashedPad
+		if err := rows.Scan(&t.ID, &t.Batch, &t.Path, &t.Size, &t.UpdatedAt, &t.DeletedAt); err != nil {
+			return nil, fmt.Errorf("scan trashed pad: %w", err)
+		}
+		trashed = append(trashed, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate trash: %w", err)
+	}
+	return trashed, nil
+}
+
+// RestoreTrash brings a trashed pad back together with the descendants that
+// were deleted along with it, including their revision history. With id 0
+// the most recent deletion of path is restored; otherwise the trash entry
+// with that id, which must belong to path. Returns ErrNotInTrash if there is
+// nothing to restore and ErrDestinationExists if a restored path is in use.
+func (s *SQLiteStore) RestoreTrash(path string, id int64) ([]*models.Pad, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin restore %q: %w", path, err)
+	}
+	defer tx.Rollback()
+
+	var batch int64
+	if id == 0 {
+		err = tx.QueryRow(
+			`SELECT batch FROM trash WHERE path = ? ORDER BY deleted_at DESC, batch DESC LIMIT 1`,
+			path,
+		).Scan(&batch)
+	} else {
+		err = tx.QueryRow(`SELECT batch FROM trash WHERE id = ? AND path = ?`, id, path).Scan(&batch)
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrNotInTrash
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find %q in trash: %w", path, err)
+	}
+
+	where, args := subtreeFilter(path)
+	args = append([]interface{}{batch}, args...)
+
+	var conflict string
+	err = tx.QueryRow(`
+		SELECT path FROM pads WHERE path IN (SELECT path FROM trash WHERE batch = ? AND `+where+`) LIMIT 1
+	`, args...).Scan(&conflict)
+	if err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDestinationExists, conflict)
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("check restore conflicts: %w", err)
+	}
+
+	// A restored pad's version stays above those of pads that were at its
+	// path since it was deleted.
+	_, err = tx.Exec(`
+		INSERT INTO pads (path, content, parent_path, version, updated_at, created_at, updated_by, created_by)
+		SELECT path, content, parent_path,
+			MAX(version, COALESCE((SELECT vacated_paths.version + 1 FROM vacated_paths WHERE vacated_paths.path = trash.path), 0)),
+			updated_at, created_at, updated_by, created_by
+		FROM trash WHERE batch = ? AND `+where,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("restore pads of %q: %w", path, err)
+	}
+
+	var paths []string
+	rows, err := tx.Query(`SELECT path FROM trash WHERE batch = ? AND `+where+` ORDER BY path`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list restored pads: %w", err)
+	}
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan restored pad: %w", err)
+		}
+		paths = append(paths, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate restored pads: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO pad_revisions (path, rev, content, created_at, created_by)
+		SELECT trash.path, trash_revisions.rev, trash_revisions.content, trash_revisions.created_at, trash_revisions.created_by
+		FROM trash_revisions JOIN trash ON trash.id = trash_revisions.trash_id
+		WHERE trash.batch = ? AND `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("restore revisions of %q: %w", path, err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM trash_revisions WHERE trash_id IN (SELECT id FROM trash WHERE batch = ? AND `+where+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("clear trashed revisions of %q: %w", path, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM trash WHERE batch = ? AND `+where, args...); err != nil {
+		return nil, fmt.Errorf("clear trash of %q: %w", path, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit restore %q: %w", path, err)
+	}
+
+	restored := make([]*models.Pad, 0, len(paths))
+	for _, p := range paths {
+		pad, err := s.GetPad(p)
+		if err != nil {
+			return nil, err
+		}
+		restored = append(restored, pad)
+	}
+	return restored, nil
+}
+
+// PurgeTrash permanently removes pads that have been in the trash longer
+// than the configured retention.
+func (s *SQLiteStore) PurgeTrash() error {
+	if s.trashRetention <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-s.trashRetention).Unix()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin purge trash: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM trash_revisions WHERE trash_id IN (SELECT id FROM trash WHERE deleted_at < ?)
+	`, cutoff)
+	if err != nil {
+		return fmt.Errorf("purge trashed revisions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM trash WHERE deleted_at < ?`, cutoff); err != nil {
+		return fmt.Errorf("purge trash: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit purge trash: %w", err)
+	}
+	return nil
+}
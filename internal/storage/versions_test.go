@@ -0,0 +1,148 @@
+//go:build sqlite_fts5
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// version returns the current version of the pad at path.
+func version(t *testing.T, s Store, path string) int64 {
+	t.Helper()
+	pad, err := s.GetPad(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pad.Version
+}
+
+func TestVersionsSurviveDelete(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	savePads(t, s, "notes", "notes", "notes/a")
+	old := version(t, s, "notes")
+
+	if _, err := s.DeletePad("notes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SavePadIfVersion("notes", "new", old, "ada"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("save against the deleted pad's version: %v, want ErrVersionConflict", err)
+	}
+	pad, err := s.SavePadIfVersion("notes", "new", 0, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pad.Version <= old {
+		t.Errorf("recreated pad has version %d, want above %d", pad.Version, old)
+	}
+	if _, err := s.SavePad("notes/a", "new", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(t, s, "notes/a"); got <= 1 {
+		t.Errorf("recreated descendant has version %d, want above 1", got)
+	}
+
+	// Restoring the first deletion puts it above the pad deleted since.
+	second := version(t, s, "notes")
+	if _, err := s.DeletePad("notes"); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := s.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first int64
+	for _, item := range trash {
+		if item.Path == "notes" && (first == 0 || item.ID < first) {
+			first = item.ID
+		}
+	}
+	if _, err := s.RestoreTrash("notes", first); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(t, s, "notes"); got <= second {
+		t.Errorf("restored pad has version %d, want above %d", got, second)
+	}
+}
+
+func TestFileVersionsSurviveDelete(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savePads(t, s, "notes", "notes", "other")
+
+	if _, err := s.DeletePad("notes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SavePadIfVersion("notes", "new", 2, "ada"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("save against the deleted pad's version: %v, want ErrVersionConflict", err)
+	}
+	if pad, err := s.SavePadIfVersion("notes", "new", 0, "ada"); err != nil || pad.Version != 3 {
+		t.Errorf("recreate = %+v, %v, want version 3", pad, err)
+	}
+
+	// A file written outside of Pathpad continues from the deleted pad too.
+	if _, err := s.DeletePad("other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.md"), []byte("by hand"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(t, s, "other"); got != 2 {
+		t.Errorf("pad recreated on disk has version %d, want 2", got)
+	}
+}
+
+func TestVersionsSurviveMove(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	savePads(t, s, "a", "a", "a", "b")
+
+	// The path a was vacated at version 3; b lands on it at version 1.
+	if _, err := s.MovePad("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MovePad("b", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(t, s, "a"); got <= 3 {
+		t.Errorf("pad moved onto a vacated path has version %d, want above 3", got)
+	}
+	if got := version(t, s, "c"); got != 3 {
+		t.Errorf("moved pad has version %d, want 3", got)
+	}
+
+	savePads(t, s, "b")
+	if got := version(t, s, "b"); got <= 1 {
+		t.Errorf("pad recreated where one was moved from has version %d, want above 1", got)
+	}
+}
+
+func TestVersionsMigration(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	savePads(t, s, "notes", "notes")
+
+	// Roll the database back to before vacated versions were recorded, with
+	// the pad deleted into the trash.
+	if _, err := s.db.Exec(`DROP TABLE vacated_paths; DELETE FROM schema_version WHERE version >= 11`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`
+		INSERT INTO trash (batch, path, parent_path, content, version, updated_at, created_at, deleted_at)
+		SELECT 1, path, parent_path, content, version, updated_at, created_at, 0 FROM pads;
+		DELETE FROM pads;
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.migrate(); err != nil {
+		t.Fatal(err)
+	}
+	savePads(t, s, "notes")
+	if got := version(t, s, "notes"); got <= 2 {
+		t.Errorf("pad recreated after migration has version %d, want above 2", got)
+	}
+}
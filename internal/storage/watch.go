@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"pathpad/internal/models"
+)
+
+// watchDebounce is how long the watcher waits for a burst of file events to
+// settle. Editors often save by removing and recreating a file, which must
+// not be reported as a deletion.
+const watchDebounce = 150 * time.Millisecond
+
+// Watch reports pads that are created, changed or deleted on disk by
+// something other than this store, such as an editor or a git checkout.
+// onChange is called with the affected paths, sorted, once the events have
+// settled. Call the returned function to stop watching.
+func (s *FileStore) Watch(onChange func(paths []string)) (stop func() error, err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.watchTree(watcher, ""); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go s.watchLoop(watcher, onChange)
+	return watcher.Close, nil
+}
+
+func (s *FileStore) watchLoop(watcher *fsnotify.Watcher, onChange func(paths []string)) {
+	pending := map[string]bool{}
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			for _, path := range s.eventPads(watcher, event) {
+				pending[path] = true
+			}
+			if len(pending) > 0 {
+				settled = time.After(watchDebounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[files] Watch error: %v", err)
+
+		case <-settled:
+			settled = nil
+			var changed []string
+			for path := range pending {
+				if s.refresh(path) {
+					changed = append(changed, path)
+				}
+			}
+			pending = map[string]bool{}
+			if len(changed) > 0 {
+				sort.Strings(changed)
+				onChange(changed)
+			}
+		}
+	}
+}
+
+// eventPads returns the pads that may be affected by a file event.
+func (s *FileStore) eventPads(watcher *fsnotify.Watcher, event fsnotify.Event) []string {
+	rel, err := filepath.Rel(s.root, event.Name)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(pathBase(rel), ".") {
+		// Temporary files of atomic writes, editor swap files, .git.
+		return nil
+	}
+
+	if strings.HasSuffix(rel, ".md") {
+		path := strings.TrimSuffix(rel, ".md")
+		if pathBase(path) == "index" {
+			path = models.ParentPath(path)
+		}
+		if models.ValidatePath(path) != nil {
+			return nil
+		}
+		return []string{path}
+	}
+
+	// Otherwise the event may concern a directory: every pad below it is
+	// affected. New directories need to be watched as well.
+	if models.ValidatePath(rel) != nil {
+		return nil
+	}
+	var paths []string
+	if event.Has(fsnotify.Create) && isDir(event.Name) {
+		found, err := s.watchTree(watcher, rel)
+		if err != nil {
+			log.Printf("[files] Failed to watch %s: %v", event.Name, err)
+		}
+		paths = append(paths, found...)
+	}
+
+	s.mu.Lock()
+	for known := range s.versions {
+		if known == rel || strings.HasPrefix(known, rel+"/") {
+			paths = append(paths, known)
+		}
+	}
+	s.mu.Unlock()
+	return paths
+}
+
+// watchTree adds watches for the directory of path and every directory
+// below it that belongs to a pad. Returns the pads found in the tree.
+func (s *FileStore) watchTree(watcher *fsnotify.Watcher, path string) ([]string, error) {
+	err := filepath.WalkDir(s.dirOf(path), func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		if rel != "." && models.ValidatePath(filepath.ToSlash(rel)) != nil {
+			return filepath.SkipDir
+		}
+		return watcher.Add(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	err = s.walkDir(path, func(padPath, file string) error {
+		paths = append(paths, padPath)
+		return nil
+	})
+	return paths, err
+}
+
+// refresh re-reads the state of a pad after its files changed and reports
+// whether it differs from what this store last wrote or reported.
+func (s *FileStore) refresh(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, info, err := s.findPad(path)
+	if err != nil {
+		log.Printf("[files] Failed to refresh pad %q: %v", path, err)
+		return false
+	}
+	if file == "" {
+		_, known := s.versions[path]
+		s.forget(path)
+		return known
+	}
+
+	prev, known := s.versions[path]
+	version := s.observe(path, info)
+	changed := !known || version != prev.version || s.changed[path]
+	delete(s.changed, path)
+	return changed
+}
@@ -4,15 +4,89 @@
 
 const BASE = '/api/pad';
 
+const TOKEN_KEY = 'pathpad_access_token';
+
+// A share link carries its token in the URL. Keep it for later requests and
+// take it out of the address bar so it isn't bookmarked or shared further.
+const linkParams = new URLSearchParams(location.search);
+if (linkParams.has('access_token')) {
+  localStorage.setItem(TOKEN_KEY, linkParams.get('access_token'));
+  linkParams.delete('access_token');
+  const query = linkParams.toString();
+  history.replaceState(history.state, '', location.pathname + (query ? `?${query}` : '') + location.hash);
+}
+
+/**
+ * The access token of this browser, if it opened a share link.
+ * @returns {string | null}
+ */
+export function accessToken() {
+  return localStorage.getItem(TOKEN_KEY);
+}
+
+const NAME_KEY = 'pathpad_name';
+
+/**
+ * The display name this browser's edits are attributed to, if set.
+ * @returns {string}
+ */
+export function displayName() {
+  return localStorage.getItem(NAME_KEY) || '';
+}
+
+/**
+ * Set the display name edits are attributed to; an empty name clears it.
+ * Signed-in users are attributed by their account name instead.
+ * @param {string} name
+ */
+export function setDisplayName(name) {
+  if (name) localStorage.setItem(NAME_KEY, name);
+  else localStorage.removeItem(NAME_KEY);
+}
+
+/**
+ * Query string identifying this client, and its display name, to the server.
+ * @param {string} clientId
+ * @returns {string}
+ */
+function clientQuery(clientId) {
+  const params = new URLSearchParams({ client_id: clientId });
+  const name = displayName();
+  if (name) params.set('name', name);
+  return params.toString();
+}
+
+/**
+ * fetch with the access token, if any, as a bearer token.
+ * @param {string} url
+ * @param {RequestInit} [init]
+ * @returns {Promise<Response>}
+ */
+function apiFetch(url, init = {}) {
+  const token = accessToken();
+  if (!token) return fetch(url, init);
+  return fetch(url, { ...init, headers: { ...init.headers, Authorization: `Bearer ${token}` } });
+}
+
 /**
  * Get pad content by path. Always returns 200 (empty content for implicit pads).
+ * access is "read" when the client may view but not edit the pad.
+ * For a password-protected pad the error has the prefix to unlock as `lock`.
  * @param {string} path
- * @returns {Promise<{path: string, content: string, updated_at: number, created_at: number}>}
+ * @returns {Promise<{path: string, content: string, version: number, updated_at: number, created_at: number, updated_by?: string, created_by?: string, access: string}>}
  */
 export async function getPad(path) {
-  const res = await fetch(`${BASE}/content/${path}`);
+  const res = await apiFetch(`${BASE}/content/${path}`);
+  if (res.status === 401) {
+    const data = await res.json();
+    const err = new Error(data.error);
+    err.lock = data.lock;
+    throw err;
+  }
   if (!res.ok) throw new Error(`Failed to get pad: ${res.status}`);
-  return res.json();
+  const pad = await res.json();
+  pad.access = res.headers.get('X-Pathpad-Access') || 'write';
+  return pad;
 }
 
 /**
@@ -23,8 +97,8 @@ export async function getPad(path) {
  * @returns {Promise<{path: string, content: string, updated_at: number, created_at: number}>}
  */
 export async function savePad(path, content, clientId) {
-  const url = `${BASE}/content/${path}?client_id=${encodeURIComponent(clientId)}`;
-  const res = await fetch(url, {
+  const url = `${BASE}/content/${path}?${clientQuery(clientId)}`;
+  const res = await apiFetch(url, {
     method: 'PUT',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify({ content }),
@@ -33,30 +107,95 @@ export async function savePad(path, content, clientId) {
   return res.json();
 }
 
+/**
+ * Submit a collaborative editing operation made against a pad version.
+ * Resolves to {version, ops} once applied, or {conflict: pad} when the server
+ * can no longer rebase the operation and the client has to resync.
+ * @param {string} path
+ * @param {number} version
+ * @param {Array} ops
+ * @param {string} clientId
+ * @returns {Promise<{version?: number, ops?: Array, conflict?: object}>}
+ */
+export async function sendOps(path, version, ops, clientId) {
+  const url = `${BASE}/ops/${path}?${clientQuery(clientId)}`;
+  const res = await apiFetch(url, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ version, ops }),
+  });
+  if (res.status === 409) {
+    const data = await res.json();
+    return { conflict: data.pad };
+  }
+  if (!res.ok) throw new Error(`Failed to send edit: ${res.status}`);
+  return res.json();
+}
+
 /**
  * Delete pad and all descendants.
+ * Deleting root or a large subtree needs confirmation: without a matching
+ * confirm count the server refuses and this resolves to {confirm: count}.
  * @param {string} path
  * @param {string} clientId
- * @returns {Promise<{deleted: number}>}
+ * @param {number} [confirm] - number of pads the caller agreed to delete
+ * @returns {Promise<{deleted: number} | {confirm: number}>}
  */
-export async function deletePad(path, clientId) {
-  const url = `${BASE}/content/${path}?client_id=${encodeURIComponent(clientId)}`;
-  const res = await fetch(url, { method: 'DELETE' });
+export async function deletePad(path, clientId, confirm) {
+  let url = `${BASE}/content/${path}?${clientQuery(clientId)}`;
+  if (confirm !== undefined) url += `&confirm=${confirm}`;
+  const res = await apiFetch(url, { method: 'DELETE' });
+  if (res.status === 409) {
+    const data = await res.json();
+    return { confirm: data.count };
+  }
   if (!res.ok) throw new Error(`Failed to delete pad: ${res.status}`);
   return res.json();
 }
 
+/**
+ * Unlock a password-protected pad. The server remembers the unlock in a cookie.
+ * Resolves to false if the password is wrong.
+ * @param {string} path
+ * @param {string} password
+ * @returns {Promise<boolean>}
+ */
+export async function unlockPad(path, password) {
+  const res = await apiFetch(`${BASE}/unlock/${path}`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ password }),
+  });
+  if (res.status === 403) return false;
+  if (!res.ok) throw new Error(`Failed to unlock pad: ${res.status}`);
+  return true;
+}
+
 /**
  * Get direct children of a pad path.
  * @param {string} path
  * @returns {Promise<{children: Array<{path: string, updated_at: number}>}>}
  */
 export async function getChildren(path) {
-  const res = await fetch(`${BASE}/children/${path}`);
+  const res = await apiFetch(`${BASE}/children/${path}`);
   if (!res.ok) throw new Error(`Failed to get children: ${res.status}`);
   return res.json();
 }
 
+/**
+ * Full-text search across pad paths and content.
+ * Snippets are HTML-escaped with matches wrapped in <mark>.
+ * @param {string} query
+ * @param {number} [limit]
+ * @returns {Promise<{results: Array<{path: string, snippet: string, updated_at: number}>}>}
+ */
+export async function searchPads(query, limit = 10) {
+  const params = new URLSearchParams({ q: query, limit: String(limit) });
+  const res = await apiFetch(`${BASE}/search?${params}`);
+  if (!res.ok) throw new Error(`Failed to search: ${res.status}`);
+  return res.json();
+}
+
 /**
  * Fire-and-forget save using fetch with keepalive (for navigating away).
  * @param {string} path
@@ -64,8 +203,8 @@ export async function getChildren(path) {
  * @param {string} clientId
  */
 export function savePadBeacon(path, content, clientId) {
-  const url = `${BASE}/content/${path}?client_id=${encodeURIComponent(clientId)}`;
-  fetch(url, {
+  const url = `${BASE}/content/${path}?${clientQuery(clientId)}`;
+  apiFetch(url, {
     method: 'PUT',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify({ content }),
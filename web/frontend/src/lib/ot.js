@@ -0,0 +1,220 @@
+/**
+ * Operational transformation for plain text, mirroring internal/ot on the server.
+ *
+ * An operation is an array walking the whole document: positive integers
+ * retain characters, negative integers delete them, and strings are inserted.
+ * Lengths are counted in Unicode code points, not UTF-16 units.
+ */
+
+/** Length of a string in code points. */
+export function cpLength(s) {
+  let n = 0;
+  for (const _ of s) n++;
+  return n;
+}
+
+/** Slice a string by code point offsets. */
+function cpSlice(s, start, end) {
+  return Array.from(s).slice(start, end).join('');
+}
+
+const isRetain = (c) => typeof c === 'number' && c > 0;
+const isDelete = (c) => typeof c === 'number' && c < 0;
+const isInsert = (c) => typeof c === 'string';
+
+/** Append a retain of n characters. */
+function retain(op, n) {
+  if (n <= 0) return;
+  if (isRetain(op[op.length - 1])) op[op.length - 1] += n;
+  else op.push(n);
+}
+
+/** Append an insertion, keeping inserts in front of an adjacent delete. */
+function insert(op, s) {
+  if (!s) return;
+  const last = op.length - 1;
+  if (isInsert(op[last])) {
+    op[last] += s;
+  } else if (isDelete(op[last])) {
+    if (isInsert(op[last - 1])) op[last - 1] += s;
+    else op.splice(last, 0, s);
+  } else {
+    op.push(s);
+  }
+}
+
+/** Append a deletion of n characters. */
+function del(op, n) {
+  if (n <= 0) return;
+  if (isDelete(op[op.length - 1])) op[op.length - 1] -= n;
+  else op.push(-n);
+}
+
+/** Whether the operation leaves the document unchanged. */
+export function isNoop(op) {
+  return op.every(isRetain);
+}
+
+/**
+ * Apply an operation to a document.
+ * @param {string} doc
+ * @param {Array} op
+ * @returns {string}
+ */
+export function apply(doc, op) {
+  const chars = Array.from(doc);
+  const out = [];
+  let pos = 0;
+  for (const c of op) {
+    if (isRetain(c)) {
+      if (pos + c > chars.length) throw new Error('operation longer than document');
+      out.push(...chars.slice(pos, pos + c));
+      pos += c;
+    } else if (isInsert(c)) {
+      out.push(c);
+    } else {
+      pos -= c;
+    }
+  }
+  if (pos !== chars.length) throw new Error('operation does not span document');
+  return out.join('');
+}
+
+/**
+ * Transform two concurrent operations a and b into [a', b'] such that
+ * apply(apply(doc, a), b') === apply(apply(doc, b), a').
+ * When both insert at the same position, a's insertion ends up first.
+ */
+export function transform(a, b) {
+  const aPrime = [];
+  const bPrime = [];
+  let i = 0;
+  let j = 0;
+  let ca = a[i++];
+  let cb = b[j++];
+
+  while (ca !== undefined || cb !== undefined) {
+    if (isInsert(ca)) {
+      insert(aPrime, ca);
+      retain(bPrime, cpLength(ca));
+      ca = a[i++];
+      continue;
+    }
+    if (isInsert(cb)) {
+      retain(aPrime, cpLength(cb));
+      insert(bPrime, cb);
+      cb = b[j++];
+      continue;
+    }
+    if (ca === undefined || cb === undefined) {
+      throw new Error('operations have different base lengths');
+    }
+
+    const la = Math.abs(ca);
+    const lb = Math.abs(cb);
+    const n = Math.min(la, lb);
+    if (isRetain(ca) && isRetain(cb)) {
+      retain(aPrime, n);
+      retain(bPrime, n);
+    } else if (isDelete(ca) && isRetain(cb)) {
+      del(aPrime, n);
+    } else if (isRetain(ca) && isDelete(cb)) {
+      del(bPrime, n);
+    }
+
+    ca = la === n ? a[i++] : Math.sign(ca) * (la - n);
+    cb = lb === n ? b[j++] : Math.sign(cb) * (lb - n);
+  }
+  return [aPrime, bPrime];
+}
+
+/**
+ * Compose two consecutive operations into one with the same effect.
+ */
+export function compose(a, b) {
+  const out = [];
+  let i = 0;
+  let j = 0;
+  let ca = a[i++];
+  let cb = b[j++];
+
+  while (ca !== undefined || cb !== undefined) {
+    if (isDelete(ca)) {
+      del(out, -ca);
+      ca = a[i++];
+      continue;
+    }
+    if (isInsert(cb)) {
+      insert(out, cb);
+      cb = b[j++];
+      continue;
+    }
+    if (ca === undefined || cb === undefined) {
+      throw new Error('operations cannot be composed');
+    }
+
+    const la = isInsert(ca) ? cpLength(ca) : ca;
+    const lb = Math.abs(cb);
+    const n = Math.min(la, lb);
+    if (isRetain(ca) && isRetain(cb)) {
+      retain(out, n);
+    } else if (isInsert(ca) && isRetain(cb)) {
+      insert(out, cpSlice(ca, 0, n));
+    } else if (isRetain(ca) && isDelete(cb)) {
+      del(out, n);
+    }
+    // Insert followed by delete cancels out.
+
+    if (la === n) ca = a[i++];
+    else ca = isInsert(ca) ? cpSlice(ca, n) : ca - n;
+    if (lb === n) cb = b[j++];
+    else cb = Math.sign(cb) * (lb - n);
+  }
+  return out;
+}
+
+/**
+ * Build an operation turning oldDoc into newDoc by replacing the region
+ * between their common prefix and suffix.
+ */
+export function diff(oldDoc, newDoc) {
+  const a = Array.from(oldDoc);
+  const b = Array.from(newDoc);
+
+  let prefix = 0;
+  while (prefix < a.length && prefix < b.length && a[prefix] === b[prefix]) prefix++;
+  let suffix = 0;
+  while (
+    suffix < a.length - prefix &&
+    suffix < b.length - prefix &&
+    a[a.length - 1 - suffix] === b[b.length - 1 - suffix]
+  ) suffix++;
+
+  const op = [];
+  retain(op, prefix);
+  insert(op, b.slice(prefix, b.length - suffix).join(''));
+  del(op, a.length - prefix - suffix);
+  retain(op, suffix);
+  return op;
+}
+
+/**
+ * Move a code point index through an operation, e.g. to keep the cursor in
+ * place when a remote edit is applied.
+ */
+export function transformIndex(index, op) {
+  let pos = 0;
+  let newIndex = index;
+  for (const c of op) {
+    if (pos > index) break;
+    if (isRetain(c)) {
+      pos += c;
+    } else if (isInsert(c)) {
+      newIndex += cpLength(c);
+    } else {
+      newIndex -= Math.min(-c, index - pos);
+      pos -= c;
+    }
+  }
+  return newIndex;
+}
@@ -2,15 +2,20 @@
  * SSE connection manager for real-time pad events.
  */
 
+import { accessToken } from './api.js';
+
 /**
  * Connect to SSE event stream for a pad path.
  * @param {string} path - pad path
  * @param {string} clientId - this client's unique ID
- * @param {object} handlers - { onUpdate, onDelete, onChildrenChanged, onConnect, onDisconnect }
+ * @param {object} handlers - { onUpdate, onOp, onDelete, onMoved, onChildrenChanged, onConnect, onDisconnect }
  * @returns {function} cleanup function to close the connection
  */
 export function connectSSE(path, clientId, handlers) {
-  const url = `/api/pad/events/${path}?client_id=${encodeURIComponent(clientId)}`;
+  let url = `/api/pad/events/${path}?client_id=${encodeURIComponent(clientId)}`;
+  // EventSource can't set headers, so the token goes in the query string.
+  const token = accessToken();
+  if (token) url += `&access_token=${encodeURIComponent(token)}`;
   const es = new EventSource(url);
 
   es.onopen = () => {
@@ -21,16 +26,28 @@ export function connectSSE(path, clientId, handlers) {
     try {
       const event = JSON.parse(e.data);
 
+      // Operations are delivered to their sender too, in order, so the
+      // editor can use its own echo as the acknowledgement.
+      if (event.type === 'op') {
+        handlers.onOp?.(event, event.client_id === clientId);
+        return;
+      }
+
       // Skip self-echoed events
       if (event.client_id === clientId) return;
 
       switch (event.type) {
         case 'update':
-          handlers.onUpdate?.(event.content);
+          // Patch-based saves carry a diff instead of the full content.
+          if (event.ops) handlers.onOp?.(event, false);
+          else handlers.onUpdate?.(event.content, event.version, event.updated_by);
           break;
         case 'delete':
           handlers.onDelete?.(event.path);
           break;
+        case 'moved':
+          handlers.onMoved?.(event.path, event.destination);
+          break;
         case 'children_changed':
           handlers.onChildrenChanged?.();
           break;
@@ -35,3 +35,6 @@ export const connected = writable(false);
 
 /** Save status: '', 'saving', 'saved', 'error' */
 export const saveStatus = writable('');
+
+/** Who last edited the current pad, if known. */
+export const lastEditedBy = writable('');